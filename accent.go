@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"strings"
+
+	"canvas/lib/stats"
+	"canvas/lib/styles"
+	"canvas/lib/utils"
+)
+
+// AccentMeta colours parts of the quote with the avatar's accent, its most
+// vibrant colour. Use lists the parts, and Palette sends the avatar's main
+// colours back in the response headers.
+type AccentMeta struct {
+	Use []string `json:"use"`
+	Palette bool `json:"palette"`
+}
+
+// what the accent can colour: the author line, minimalist's border, and
+// the classic gradient or minimalist wash.
+var accent_uses = []string{ "author", "border", "gradient" };
+
+// how many colours the palette has, and how much of the accent goes into
+// the gradient.
+const palette_size = 5;
+const accent_tint = 0.5;
+
+// uses is Use lowercased and checked.
+func (meta AccentMeta) uses() (map[string]bool, error) {
+	uses := map[string]bool{};
+	for _, use := range meta.Use {
+		use = strings.ToLower(use);
+		known := false;
+		for _, u := range accent_uses {
+			known = known || use == u;
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown accent use %q, have: %s", use, strings.Join(accent_uses, ", "));
+		}
+		uses[use] = true;
+	}
+	return uses, nil;
+}
+
+// palette is the avatar's main colours, from its first frame when it's a
+// gif.
+func (a *avatar) palette() []stats.Swatch {
+	img := a.first();
+	return stats.DominantColors(img, img.Bounds(), palette_size);
+}
+
+// applyAccent colours the parts uses asks for. the gradient and the
+// theme's overlay get tinted, and minimalist frames without an overlay get
+// a wash of the accent itself. it's all done to the theme and gradient, so
+// gif styles keep these colours in their palettes like any others.
+func applyAccent(uses map[string]bool, accent color.NRGBA, theme *styles.Theme, gradient *utils.Gradient) {
+	if uses["author"] {
+		theme.Author = accent;
+	}
+	if uses["border"] {
+		theme.Border = accent;
+	}
+	if uses["gradient"] {
+		gradient.From = tint(gradient.From, accent);
+		gradient.To = tint(gradient.To, accent);
+		if theme.Overlay == nil {
+			theme.Overlay = accent;
+		} else {
+			theme.Overlay = tint(color.NRGBAModel.Convert(theme.Overlay).(color.NRGBA), accent);
+		}
+	}
+}
+
+// tint mixes accent into c, keeping c's alpha.
+func tint(c, accent color.NRGBA) color.NRGBA {
+	mix := func(a, b uint8) uint8 {
+		return uint8(float64(a) + (float64(b) - float64(a)) * accent_tint + 0.5);
+	};
+	return color.NRGBA{ mix(c.R, accent.R), mix(c.G, accent.G), mix(c.B, accent.B), c.A };
+}
+
+// hexColor is c as #rrggbb.
+func hexColor(c color.NRGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B);
+}
+
+// paletteHeader lists the swatches as hex with their share of the avatar,
+// most common first, like "#1e1b4b 0.62, #f9c74f 0.21".
+func paletteHeader(swatches []stats.Swatch) string {
+	parts := make([]string, len(swatches));
+	for i, s := range swatches {
+		parts[i] = fmt.Sprintf("%s %.2f", hexColor(s.Color), s.Share);
+	}
+	return strings.Join(parts, ", ");
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+)
+
+// busyGif is a data url of a gif whose frames each have a palette of their
+// own, more colours than fit in one.
+func busyGif(t *testing.T, width, height, frames int) string {
+	t.Helper();
+	animation := &gif.GIF{};
+	for f := 0; f < frames; f++ {
+		colors := make(color.Palette, 256);
+		for i := range colors {
+			colors[i] = color.RGBA{ uint8(i), uint8(i * 7 + f * 50), uint8(i * 13 + f * 90), 255 };
+		}
+		img := image.NewPaletted(image.Rect(0, 0, width, height), colors);
+		for i := range img.Pix {
+			img.Pix[i] = uint8(i * 31 / width);
+		}
+		animation.Image = append(animation.Image, img);
+		animation.Delay = append(animation.Delay, 10);
+	}
+	var buf bytes.Buffer;
+	if err := gif.EncodeAll(&buf, animation); err != nil {
+		t.Fatal(err);
+	}
+	return "data:image/gif;base64," + base64.StdEncoding.EncodeToString(buf.Bytes());
+}
+
+// the accent comes out in a gif's palette as it is, in the parts it
+// colours, not averaged into the avatar's colours.
+func TestAccentInGifPalette(t *testing.T) {
+	setupTest(t);
+	animated := busyGif(t, 160, 120, 3);
+	for _, style := range []string{ style_classic, style_minimalist } {
+		meta := Meta{
+			Gradient: defaultGradientMeta(),
+			Url: animated,
+			Author: "Someone",
+			Text: "a quote with an accent",
+			Style: style,
+			Width: 640,
+			Height: 360,
+			Accent: AccentMeta{ Use: accent_uses, Palette: true },
+		};
+		rendered, err := renderQuote(&meta, nil, nil);
+		if err != nil {
+			t.Fatalf("%s: %v", style, err);
+		}
+		if rendered.Accent == nil {
+			t.Fatalf("%s: the avatar has no accent", style);
+		}
+		out, err := gif.DecodeAll(bytes.NewReader(rendered.Data));
+		if err != nil {
+			t.Fatalf("%s: %v", style, err);
+		}
+		want := color.RGBAModel.Convert(*rendered.Accent);
+		for i, frame := range out.Image {
+			found := false;
+			for _, index := range frame.Pix {
+				found = found || color.RGBAModel.Convert(frame.Palette[index]) == want;
+			}
+			if !found {
+				t.Errorf("%s: frame %d has no pixel of the accent %s", style, i, hexColor(*rendered.Accent));
+			}
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"canvas/lib/utils"
+)
+
+// the default assets, so the binary runs from any working directory.
+//
+//go:embed fonts
+var embedded_assets embed.FS
+
+// openAssets returns the embedded assets, with dir laid over them when
+// it's set. fonts in dir/fonts are loaded next to the bundled ones, and
+// win over them when they have the same file name.
+func openAssets(dir string) (fs.FS, error) {
+	if dir == "" {
+		return embedded_assets, nil;
+	}
+	info, err := os.Stat(dir);
+	if err != nil {
+		return nil, fmt.Errorf("asset dir: %w", err);
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("asset dir: %s is not a directory", dir);
+	}
+	return utils.OverlayFS{ Top: os.DirFS(dir), Bottom: embedded_assets }, nil;
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// BatchMeta is several quote requests rendered together. Format is zip
+// (the default) or multipart.
+type BatchMeta struct {
+	Format string `json:"format"`
+	Requests []json.RawMessage `json:"requests"`
+}
+
+const max_batch_items = 25;
+
+// batchResult is how one request of a batch went. Rendered is nil when it
+// failed, with Status and Error saying why.
+type batchResult struct {
+	Status int
+	Error string
+	Rendered *Rendered
+}
+
+// BatchItem is one entry of a zip's manifest.json.
+type BatchItem struct {
+	Index int `json:"index"`
+	Status int `json:"status"`
+	File string `json:"file,omitempty"`
+	Error string `json:"error,omitempty"`
+	Accent string `json:"accent,omitempty"`
+	Palette string `json:"palette,omitempty"`
+}
+
+// renderBatch renders every request, as many at once as there are free
+// workers. avatars and attachments asked for more than once are fetched once.
+func renderBatch(requests []json.RawMessage) []batchResult {
+	results := make([]batchResult, len(requests));
+	cache := newFetchCache();
+	var wg sync.WaitGroup;
+	for i, raw := range requests {
+		wg.Add(1);
+		go func(i int, raw json.RawMessage) {
+			defer wg.Done();
+			meta := Meta{ Gradient: defaultGradientMeta() };
+			if err := json.Unmarshal(raw, &meta); err != nil {
+				results[i] = batchResult{ Status: http.StatusBadRequest, Error: "Failed to parse metadata." };
+				return;
+			}
+			rendered, err := renderLimited(&meta, cache, nil);
+			if err != nil {
+				results[i] = batchResult{ Status: statusOf(err), Error: err.Error() };
+				return;
+			}
+			results[i] = batchResult{ Status: http.StatusOK, Rendered: rendered };
+		}(i, raw);
+	}
+	wg.Wait();
+	return results;
+}
+
+// fileName is what result i is called in the response.
+func (result batchResult) fileName(i int) string {
+	ext := "txt";
+	if result.Rendered != nil {
+		ext = strings.TrimPrefix(result.Rendered.ContentType, "image/");
+	}
+	return fmt.Sprintf("%03d.%s", i, ext);
+}
+
+// writeZip puts each quote in the archive by its index, with a manifest of
+// how every request went. failed requests only show up in the manifest.
+func writeZip(w io.Writer, results []batchResult) error {
+	archive := zip.NewWriter(w);
+	manifest := make([]BatchItem, len(results));
+	for i, result := range results {
+		manifest[i] = BatchItem{ Index: i, Status: result.Status, Error: result.Error };
+		if result.Rendered == nil {
+			continue;
+		}
+		manifest[i].File = result.fileName(i);
+		if result.Rendered.Palette != nil {
+			manifest[i].Palette = paletteHeader(result.Rendered.Palette);
+		}
+		if result.Rendered.Accent != nil {
+			manifest[i].Accent = hexColor(*result.Rendered.Accent);
+		}
+		// pngs and gifs are already compressed.
+		file, err := archive.CreateHeader(&zip.FileHeader{ Name: manifest[i].File, Method: zip.Store });
+		if err != nil {
+			return err;
+		}
+		if _, err := file.Write(result.Rendered.Data); err != nil {
+			return err;
+		}
+	}
+	file, err := archive.Create("manifest.json");
+	if err != nil {
+		return err;
+	}
+	encoder := json.NewEncoder(file);
+	encoder.SetIndent("", "\t");
+	if err := encoder.Encode(manifest); err != nil {
+		return err;
+	}
+	return archive.Close();
+}
+
+// writeMultipart sends a part per request, in order. each has the status in
+// X-Status, and the quote or the error as its body.
+func writeMultipart(w http.ResponseWriter, results []batchResult) error {
+	parts := multipart.NewWriter(w);
+	w.Header().Set("Content-Type", "multipart/mixed; boundary=" + parts.Boundary());
+	for i, result := range results {
+		header := textproto.MIMEHeader{};
+		header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", result.fileName(i)));
+		header.Set("X-Index", strconv.Itoa(i));
+		header.Set("X-Status", strconv.Itoa(result.Status));
+		body := []byte(result.Error);
+		if result.Rendered != nil {
+			header.Set("Content-Type", result.Rendered.ContentType);
+			if result.Rendered.Palette != nil {
+				header.Set("X-Palette", paletteHeader(result.Rendered.Palette));
+			}
+			if result.Rendered.Accent != nil {
+				header.Set("X-Accent", hexColor(*result.Rendered.Accent));
+			}
+			body = result.Rendered.Data;
+		} else {
+			header.Set("Content-Type", "text/plain; charset=utf-8");
+		}
+		part, err := parts.CreatePart(header);
+		if err != nil {
+			return err;
+		}
+		if _, err := part.Write(body); err != nil {
+			return err;
+		}
+	}
+	return parts.Close();
+}
+
+func sendBatch(w http.ResponseWriter, r *http.Request) {
+	reqBody, ok := readBody(w, r, max_batch_body_bytes);
+	if !ok {
+		return;
+	}
+	var batch BatchMeta;
+	if err := json.Unmarshal(reqBody, &batch); err != nil {
+		http.Error(w, "Failed to parse batch.", http.StatusBadRequest);
+		return;
+	}
+	format := strings.ToLower(batch.Format);
+	if format != "" && format != "zip" && format != "multipart" {
+		http.Error(w, fmt.Sprintf("unknown batch format %q, have: zip, multipart", batch.Format), http.StatusBadRequest);
+		return;
+	}
+	if len(batch.Requests) == 0 || len(batch.Requests) > max_batch_items {
+		http.Error(w, fmt.Sprintf("a batch needs 1 to %d requests, got %d", max_batch_items, len(batch.Requests)), http.StatusBadRequest);
+		return;
+	}
+
+	results := renderBatch(batch.Requests);
+	if format == "multipart" {
+		writeMultipart(w, results);
+		return;
+	}
+	// the archive is built first, so a failure can still be an error.
+	var buf bytes.Buffer;
+	if err := writeZip(&buf, results); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError);
+		return;
+	}
+	w.Header().Set("Content-Type", "application/zip");
+	w.Header().Set("Content-Disposition", `attachment; filename="quotes.zip"`);
+	w.Write(buf.Bytes());
+}
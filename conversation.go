@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+
+	"canvas/lib/layout"
+	"canvas/lib/styles"
+)
+
+// MessageMeta is one message of a conversation. Timestamp is RFC 3339 and
+// gets the request's date_format and time_zone.
+type MessageMeta struct {
+	Author string `json:"author"`
+	AvatarUrl string `json:"avatar_url"`
+	Text string `json:"text"`
+	AttachmentUrl string `json:"attachment_url"`
+	Timestamp string `json:"timestamp"`
+}
+
+// a conversation is a short exchange, not a whole channel.
+const max_messages = 50;
+
+// text size in a conversation at its default width.
+const conversation_size = 32;
+
+// continues is whether message is by the same author as previous, so
+// they're shown as one group.
+func (message MessageMeta) continues(previous MessageMeta) bool {
+	return message.Author == previous.Author && message.AvatarUrl == previous.AvatarUrl;
+}
+
+// prepareConversation is prepareQuote for meta.Messages, drawn stacked like
+// a chat, as a png.
+func prepareConversation(meta *Meta, style string, theme styles.Theme, faces_at layout.FacesAt, cache *fetchCache) (renderFunc, error) {
+	if len(meta.Messages) > max_messages {
+		return nil, badRequestf("a conversation can have up to %d messages, got %d", max_messages, len(meta.Messages));
+	}
+	if meta.Height != 0 || meta.Aspect != "" {
+		return nil, badRequestf("conversations fit their height to the messages, only width can be given");
+	}
+	// the height fits the messages, the width is the style's unless given.
+	width := meta.Width;
+	if width == 0 {
+		width = styles.ConversationWidth;
+	}
+	if width < min_output_side || width > max_output_side {
+		return nil, badRequestf("width has to be between %d and %d, got %d", min_output_side, max_output_side, width);
+	}
+	scale := styles.ConversationScale(width);
+
+	avatar_filters, err := meta.avatarFilters(style, scale);
+	if err != nil {
+		return nil, &badRequest{ err };
+	}
+	avatar_crop, err := meta.Crop.crop();
+	if err != nil {
+		return nil, &badRequest{ err };
+	}
+	contrast, err := meta.Contrast.contrast();
+	if err != nil {
+		return nil, &badRequest{ err };
+	}
+
+	// the same avatar is only fetched once, however many messages it has.
+	fetch := &fetcher{ cache: cache };
+	watermark, err := meta.requestWatermark(fetch, faces_at);
+	if err != nil {
+		return nil, &badRequest{ err };
+	}
+	avatars := map[string]image.Image{};
+	messages := make([]styles.Message, len(meta.Messages));
+	for i, m := range meta.Messages {
+		if err := checkText("the text", m.Text, nil); err != nil {
+			return nil, badRequestf("message %d: %w", i, err);
+		}
+		if err := checkText("the author", m.Author, nil); err != nil {
+			return nil, badRequestf("message %d: %w", i, err);
+		}
+		date, err := meta.formatDate(m.Timestamp);
+		if err != nil {
+			return nil, badRequestf("message %d: %w", i, err);
+		}
+		message := styles.Message{
+			Author: []layout.Run{ { Text: m.Author } },
+			Text: layout.ParseMarkdown(m.Text),
+			Continues: i > 0 && m.continues(meta.Messages[i-1]),
+		};
+		if date != "" {
+			message.Details = []layout.Run{ { Text: date, Style: layout.Style{ Scale: details_scale } } };
+		}
+		if m.AvatarUrl != "" && !message.Continues {
+			if _, ok := avatars[m.AvatarUrl]; !ok {
+				avatar, err := fetch.image(m.AvatarUrl);
+				if err != nil {
+					return nil, badRequestf("message %d: Can't get image from URL. %w", i, err);
+				}
+				avatars[m.AvatarUrl] = avatar.first();
+			}
+			message.Avatar = avatars[m.AvatarUrl];
+		}
+		if m.AttachmentUrl != "" {
+			attachment, err := fetch.image(m.AttachmentUrl);
+			if err != nil {
+				return nil, badRequestf("message %d: Can't get attachment from URL. %w", i, err);
+			}
+			message.Attachment = attachment.first();
+		}
+		messages[i] = message;
+	}
+
+	return func(progress styles.Progress) (*Rendered, error) {
+		conversation := styles.LayoutConversation(messages, width, faces_at(conversation_size * scale));
+		size := conversation.Size();
+		if size.Y > max_output_side || size.X * size.Y > max_output_pixels {
+			return nil, badRequestf("the conversation comes out %dx%d, too big for sides up to %d and %d pixels in all; send fewer or shorter messages", size.X, size.Y, max_output_side, max_output_pixels);
+		}
+		out := styles.DrawConversation(conversation, theme, styles.RenderOptions{ Filters: avatar_filters, Crop: avatar_crop, Contrast: contrast, Watermark: watermark });
+
+		var buf bytes.Buffer;
+		if err := png.Encode(&buf, out.Image()); err != nil {
+			return nil, err;
+		}
+		return &Rendered{ ContentType: "image/png", Data: buf.Bytes() }, nil;
+	}, nil;
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	_ "time/tzdata" // time zones work without the system's database
+
+	"canvas/lib/layout"
+)
+
+// named date formats a request can use instead of a go layout.
+var date_formats = map[string]string{
+	"date": "2 January 2006",
+	"datetime": "2 January 2006 at 15:04",
+	"short": "02/01/2006 15:04",
+	"iso": "2006-01-02 15:04",
+	"time": "15:04",
+};
+
+const default_date_format = "datetime";
+
+// how big the handle and details are next to the author line.
+const handle_scale = 0.75;
+const details_scale = 0.7;
+
+// formatDate formats timestamp the way the request asks, empty when there
+// isn't one.
+func (meta *Meta) formatDate(timestamp string) (string, error) {
+	if timestamp == "" {
+		return "", nil;
+	}
+	t, err := time.Parse(time.RFC3339Nano, timestamp);
+	if err != nil {
+		return "", fmt.Errorf("timestamp has to be RFC 3339, like 2024-03-12T10:15:00Z: %w", err);
+	}
+	if meta.TimeZone != "" {
+		zone, err := time.LoadLocation(meta.TimeZone);
+		if err != nil {
+			return "", fmt.Errorf("unknown time zone %q", meta.TimeZone);
+		}
+		t = t.In(zone);
+	}
+	format := meta.DateFormat;
+	if format == "" {
+		format = default_date_format;
+	}
+	if named, ok := date_formats[format]; ok {
+		format = named;
+	}
+	return t.Format(format), nil;
+}
+
+// place is "#channel in Server", or whichever half the request has.
+func (meta *Meta) place() string {
+	channel := meta.Channel;
+	if channel != "" && !strings.HasPrefix(channel, "#") {
+		channel = "#" + channel;
+	}
+	switch {
+	case channel != "" && meta.Server != "":
+		return channel + " in " + meta.Server;
+	case channel != "":
+		return channel;
+	}
+	return meta.Server;
+}
+
+// handle is the author's handle with its @, empty when there isn't one.
+func (meta *Meta) handle() string {
+	if meta.Handle == "" || strings.HasPrefix(meta.Handle, "@") {
+		return meta.Handle;
+	}
+	return "@" + meta.Handle;
+}
+
+// withHandle puts the handle under the author line, smaller.
+func (meta *Meta) withHandle(author []layout.Run) []layout.Run {
+	handle := meta.handle();
+	if handle == "" {
+		return author;
+	}
+	return append(author, layout.Run{ Text: "\n" }, layout.Run{ Text: handle, Style: layout.Style{ Scale: handle_scale } });
+}
+
+// detailRuns is the small print under the quote: the place and the date,
+// and the handle first when with_handle is set, for styles that have no
+// author line to put it under. nil when there's nothing to show.
+func (meta *Meta) detailRuns(with_handle bool) ([]layout.Run, error) {
+	date, err := meta.formatDate(meta.Timestamp);
+	if err != nil {
+		return nil, err;
+	}
+	var parts []string;
+	for _, part := range []string{ meta.place(), date } {
+		if part != "" {
+			parts = append(parts, part);
+		}
+	}
+	if with_handle && meta.handle() != "" {
+		parts = append([]string{ meta.handle() }, parts...);
+	}
+	if len(parts) == 0 {
+		return nil, nil;
+	}
+	return []layout.Run{ { Text: strings.Join(parts, " · "), Style: layout.Style{ Scale: details_scale } } }, nil;
+}
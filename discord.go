@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// discord sends interactions here when the server is the app's
+// interactions endpoint, which it is when it has the app's public key.
+// the "Make it a Quote" message command turns the message it's used on into
+// a quote, put in the deferred response once it's rendered.
+
+// interaction and response types, and message flags, from discord's docs.
+const (
+	interaction_ping = 1
+	interaction_command = 2
+	command_message = 3
+	response_pong = 1
+	response_deferred = 5
+	flag_ephemeral = 64
+)
+
+const discord_timeout = 30 * time.Second;
+const max_interaction_bytes = 1 << 20;
+
+var discord_client = &http.Client{ Timeout: discord_timeout };
+
+// discordApp is what the server needs to talk to discord. Api and Cdn are
+// base urls, so they can point somewhere else for testing.
+type discordApp struct {
+	key ed25519.PublicKey
+	api string
+	cdn string
+}
+
+var discord *discordApp;
+
+func newDiscordApp(key_hex, api, cdn string) (*discordApp, error) {
+	key, err := hex.DecodeString(key_hex);
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("discord key has to be %d bytes of hex", ed25519.PublicKeySize);
+	}
+	return &discordApp{
+		key: key,
+		api: strings.TrimSuffix(api, "/"),
+		cdn: strings.TrimSuffix(cdn, "/"),
+	}, nil;
+}
+
+type discordUser struct {
+	Id string `json:"id"`
+	Username string `json:"username"`
+	GlobalName string `json:"global_name"`
+	Avatar string `json:"avatar"`
+}
+
+type discordAttachment struct {
+	Url string `json:"url"`
+	ContentType string `json:"content_type"`
+}
+
+type discordMessage struct {
+	Content string `json:"content"`
+	Timestamp string `json:"timestamp"`
+	Author discordUser `json:"author"`
+	Attachments []discordAttachment `json:"attachments"`
+}
+
+type discordInteraction struct {
+	Type int `json:"type"`
+	ApplicationId string `json:"application_id"`
+	Token string `json:"token"`
+	Data struct {
+		Type int `json:"type"`
+		TargetId string `json:"target_id"`
+		Resolved struct {
+			Messages map[string]discordMessage `json:"messages"`
+		} `json:"resolved"`
+	} `json:"data"`
+}
+
+// verify checks the request was signed by discord: the signature is over
+// the timestamp and then the body.
+func (app *discordApp) verify(r *http.Request, body []byte) bool {
+	signature, err := hex.DecodeString(r.Header.Get("X-Signature-Ed25519"));
+	if err != nil || len(signature) != ed25519.SignatureSize {
+		return false;
+	}
+	timestamp := r.Header.Get("X-Signature-Timestamp");
+	return ed25519.Verify(app.key, append([]byte(timestamp), body...), signature);
+}
+
+// avatarUrl is the user's avatar on the cdn, a gif when it's animated, or
+// one of discord's default ones when they haven't set any.
+func (app *discordApp) avatarUrl(user discordUser) string {
+	if user.Avatar == "" {
+		id, _ := strconv.ParseUint(user.Id, 10, 64);
+		return fmt.Sprintf("%s/embed/avatars/%d.png", app.cdn, (id >> 22) % 6);
+	}
+	ext := "png";
+	if strings.HasPrefix(user.Avatar, "a_") {
+		ext = "gif";
+	}
+	return fmt.Sprintf("%s/avatars/%s/%s.%s?size=512", app.cdn, user.Id, user.Avatar, ext);
+}
+
+// quoteMeta is the quote request for message: its text, author and first
+// image, as the classic style with everything else left default.
+func (app *discordApp) quoteMeta(message discordMessage) Meta {
+	author := message.Author.GlobalName;
+	if author == "" {
+		author = message.Author.Username;
+	}
+	meta := Meta{
+		Gradient: defaultGradientMeta(),
+		Url: app.avatarUrl(message.Author),
+		Author: author,
+		Text: message.Content,
+		Handle: message.Author.Username,
+		Timestamp: message.Timestamp,
+	};
+	for _, a := range message.Attachments {
+		if strings.HasPrefix(a.ContentType, "image/") {
+			meta.Attachment = AttachmentMeta{ Url: a.Url };
+			break;
+		}
+	}
+	return meta;
+}
+
+// quote renders message and puts it in the deferred response, or says
+// what went wrong, just to whoever used the command.
+func (app *discordApp) quote(interaction discordInteraction, message discordMessage) {
+	meta := app.quoteMeta(message);
+	if meta.Text == "" && meta.Attachment.Url == "" {
+		app.fail(interaction, "There's nothing in that message to quote.");
+		return;
+	}
+	rendered, err := renderLimited(&meta, nil, nil);
+	if err != nil {
+		app.fail(interaction, "Couldn't make that a quote: " + err.Error());
+		return;
+	}
+	app.reply(interaction, rendered);
+}
+
+// webhook is the interaction's webhook, or path under it.
+func (app *discordApp) webhook(interaction discordInteraction, path string) string {
+	return fmt.Sprintf("%s/webhooks/%s/%s%s", app.api, interaction.ApplicationId, interaction.Token, path);
+}
+
+// reply puts the quote in the deferred response's message, in place of
+// discord's "thinking".
+func (app *discordApp) reply(interaction discordInteraction, rendered *Rendered) {
+	body, content_type := messageBody(map[string]any{ "content": "" }, rendered);
+	app.call(http.MethodPatch, app.webhook(interaction, "/messages/@original"), content_type, body);
+}
+
+// fail tells whoever used the command what went wrong. the deferred
+// response is seen by everyone, and can't be made ephemeral after the fact,
+// so it's deleted and the error goes in an ephemeral follow-up.
+func (app *discordApp) fail(interaction discordInteraction, content string) {
+	app.call(http.MethodDelete, app.webhook(interaction, "/messages/@original"), "", nil);
+	body, content_type := messageBody(map[string]any{ "content": content, "flags": flag_ephemeral }, nil);
+	app.call(http.MethodPost, app.webhook(interaction, ""), content_type, body);
+}
+
+// messageBody is a message for the webhook as a multipart form, with the
+// quote attached when there is one.
+func messageBody(payload map[string]any, rendered *Rendered) (io.Reader, string) {
+	file := "";
+	if rendered != nil {
+		file = "quote." + strings.TrimPrefix(rendered.ContentType, "image/");
+		payload["attachments"] = []map[string]any{ { "id": 0, "filename": file } };
+	}
+	payload_json, _ := json.Marshal(payload);
+
+	var body bytes.Buffer;
+	parts := multipart.NewWriter(&body);
+	header := textproto.MIMEHeader{};
+	header.Set("Content-Disposition", `form-data; name="payload_json"`);
+	header.Set("Content-Type", "application/json");
+	part, _ := parts.CreatePart(header);
+	part.Write(payload_json);
+	if rendered != nil {
+		header := textproto.MIMEHeader{};
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="files[0]"; filename=%q`, file));
+		header.Set("Content-Type", rendered.ContentType);
+		part, _ := parts.CreatePart(header);
+		part.Write(rendered.Data);
+	}
+	parts.Close();
+	return &body, parts.FormDataContentType();
+}
+
+// call sends a request to discord, logging it when it fails.
+func (app *discordApp) call(method, link, content_type string, body io.Reader) {
+	req, err := http.NewRequest(method, link, body);
+	if err != nil {
+		log.Printf("discord %s: %v", method, err);
+		return;
+	}
+	if content_type != "" {
+		req.Header.Set("Content-Type", content_type);
+	}
+	resp, err := discord_client.Do(req);
+	if err != nil {
+		log.Printf("discord %s: %v", method, err);
+		return;
+	}
+	defer resp.Body.Close();
+	if resp.StatusCode >= 300 {
+		reason, _ := io.ReadAll(io.LimitReader(resp.Body, 512));
+		log.Printf("discord %s: %s: %s", method, resp.Status, reason);
+	}
+}
+
+// discordInteractions answers discord: pings straight away, and message
+// commands with a deferred response, the quote filling it in once it's
+// ready.
+func discordInteractions(w http.ResponseWriter, r *http.Request) {
+	body, ok := readBody(w, r, max_interaction_bytes);
+	if !ok {
+		return;
+	}
+	if !discord.verify(r, body) {
+		http.Error(w, "invalid request signature", http.StatusUnauthorized);
+		return;
+	}
+	var interaction discordInteraction;
+	if err := json.Unmarshal(body, &interaction); err != nil {
+		http.Error(w, "Failed to parse interaction.", http.StatusBadRequest);
+		return;
+	}
+
+	switch interaction.Type {
+	case interaction_ping:
+		writeJson(w, http.StatusOK, map[string]int{ "type": response_pong });
+	case interaction_command:
+		message, ok := interaction.Data.Resolved.Messages[interaction.Data.TargetId];
+		if interaction.Data.Type != command_message || !ok {
+			http.Error(w, "only message commands are handled", http.StatusBadRequest);
+			return;
+		}
+		// discord wants an answer in 3 seconds, a gif can take longer.
+		go discord.quote(interaction, message);
+		writeJson(w, http.StatusOK, map[string]int{ "type": response_deferred });
+	default:
+		http.Error(w, fmt.Sprintf("unhandled interaction type %d", interaction.Type), http.StatusBadRequest);
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"image"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// webhookCall is a request the stand-in for discord's api got.
+type webhookCall struct {
+	method, path string
+	payload map[string]any
+	file_type string
+	file []byte
+}
+
+// testDiscord points discord at stand-ins for its api and cdn, signed with
+// a new key. calls has every request the api gets.
+func testDiscord(t *testing.T) (key ed25519.PrivateKey, calls chan webhookCall) {
+	t.Helper();
+	setupTest(t);
+	public, key, err := ed25519.GenerateKey(rand.Reader);
+	if err != nil {
+		t.Fatal(err);
+	}
+
+	calls = make(chan webhookCall, 8);
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		call := webhookCall{ method: r.Method, path: r.URL.Path };
+		_, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"));
+		if params["boundary"] != "" {
+			parts := multipart.NewReader(r.Body, params["boundary"]);
+			for part, err := parts.NextPart(); err == nil; part, err = parts.NextPart() {
+				data, _ := io.ReadAll(part);
+				if part.FormName() == "payload_json" {
+					json.Unmarshal(data, &call.payload);
+				} else {
+					call.file_type, call.file = part.Header.Get("Content-Type"), data;
+				}
+			}
+		}
+		calls <- call;
+		w.WriteHeader(http.StatusNoContent);
+	}));
+	t.Cleanup(api.Close);
+
+	avatar, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(testAvatar(t, 128, 128, 1), "data:image/png;base64,"));
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png");
+		w.Write(avatar);
+	}));
+	t.Cleanup(cdn.Close);
+
+	saved := discord;
+	discord, err = newDiscordApp(hex.EncodeToString(public), api.URL, cdn.URL);
+	if err != nil {
+		t.Fatal(err);
+	}
+	t.Cleanup(func() { discord = saved });
+	return key, calls;
+}
+
+// interact sends body to the interactions endpoint, signed with key.
+func interact(key ed25519.PrivateKey, body string) *httptest.ResponseRecorder {
+	timestamp := "1700000000";
+	r := httptest.NewRequest(http.MethodPost, "/discord/interactions", strings.NewReader(body));
+	r.Header.Set("X-Signature-Timestamp", timestamp);
+	r.Header.Set("X-Signature-Ed25519", hex.EncodeToString(ed25519.Sign(key, []byte(timestamp + body))));
+	w := httptest.NewRecorder();
+	discordInteractions(w, r);
+	return w;
+}
+
+func nextCall(t *testing.T, calls chan webhookCall) webhookCall {
+	t.Helper();
+	select {
+	case call := <-calls:
+		return call;
+	case <-time.After(20 * time.Second):
+		t.Fatal("discord never heard back");
+	}
+	return webhookCall{};
+}
+
+// messageCommand is the interaction for using the command on a message
+// saying content.
+func messageCommand(content string) string {
+	quoted, _ := json.Marshal(content);
+	return `{"type":2,"application_id":"app","token":"tok","data":{"type":3,"target_id":"1","resolved":{"messages":{"1":{
+		"content":` + string(quoted) + `,"timestamp":"2024-05-01T12:00:00Z",
+		"author":{"id":"80351110224678912","username":"someone","global_name":"Someone","avatar":"abc"}}}}}}`;
+}
+
+func TestDiscordPing(t *testing.T) {
+	key, _ := testDiscord(t);
+	w := interact(key, `{"type":1}`);
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != `{"type":1}` {
+		t.Errorf("ping got %d %s, want a pong", w.Code, w.Body);
+	}
+}
+
+func TestDiscordBadSignature(t *testing.T) {
+	testDiscord(t);
+	_, other, _ := ed25519.GenerateKey(rand.Reader);
+	if w := interact(other, `{"type":1}`); w.Code != http.StatusUnauthorized {
+		t.Errorf("a ping signed with another key got %d, want 401", w.Code);
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/discord/interactions", strings.NewReader(`{"type":1}`));
+	w := httptest.NewRecorder();
+	discordInteractions(w, r);
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("an unsigned ping got %d, want 401", w.Code);
+	}
+}
+
+func TestDiscordSignatureCoversBody(t *testing.T) {
+	key, _ := testDiscord(t);
+	timestamp, body := "1700000000", `{"type":1}`;
+	r := httptest.NewRequest(http.MethodPost, "/discord/interactions", strings.NewReader(`{"type":2}`));
+	r.Header.Set("X-Signature-Timestamp", timestamp);
+	r.Header.Set("X-Signature-Ed25519", hex.EncodeToString(ed25519.Sign(key, []byte(timestamp + body))));
+	w := httptest.NewRecorder();
+	discordInteractions(w, r);
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("a changed body got %d, want 401", w.Code);
+	}
+}
+
+// the quote fills in the deferred response, for everyone to see.
+func TestDiscordQuote(t *testing.T) {
+	key, calls := testDiscord(t);
+	w := interact(key, messageCommand("Quote **this** one"));
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != `{"type":5}` {
+		t.Fatalf("the command got %d %s, want a deferred response", w.Code, w.Body);
+	}
+	call := nextCall(t, calls);
+	if call.method != http.MethodPatch || call.path != "/webhooks/app/tok/messages/@original" {
+		t.Fatalf("got %s %s, want the original response edited", call.method, call.path);
+	}
+	if call.payload["flags"] != nil {
+		t.Errorf("the quote has flags %v, want it public", call.payload["flags"]);
+	}
+	if call.file_type != "image/png" {
+		t.Fatalf("the quote came as %q, want a png", call.file_type);
+	}
+	if _, _, err := image.Decode(bytes.NewReader(call.file)); err != nil {
+		t.Errorf("the quote doesn't decode: %v", err);
+	}
+}
+
+// errors are only shown to whoever used the command: the public deferred
+// response goes, and an ephemeral follow-up says why.
+func TestDiscordQuoteError(t *testing.T) {
+	key, calls := testDiscord(t);
+	if w := interact(key, messageCommand("")); w.Code != http.StatusOK {
+		t.Fatalf("the command got %d", w.Code);
+	}
+	deleted := nextCall(t, calls);
+	if deleted.method != http.MethodDelete || deleted.path != "/webhooks/app/tok/messages/@original" {
+		t.Errorf("got %s %s, want the original response deleted", deleted.method, deleted.path);
+	}
+	follow_up := nextCall(t, calls);
+	if follow_up.method != http.MethodPost || follow_up.path != "/webhooks/app/tok" {
+		t.Fatalf("got %s %s, want a follow-up", follow_up.method, follow_up.path);
+	}
+	if follow_up.payload["flags"] != float64(flag_ephemeral) {
+		t.Errorf("the error has flags %v, want it ephemeral", follow_up.payload["flags"]);
+	}
+	if content, _ := follow_up.payload["content"].(string); !strings.Contains(content, "nothing in that message") {
+		t.Errorf("the error says %q", content);
+	}
+	if follow_up.file != nil {
+		t.Errorf("the error came with a file");
+	}
+}
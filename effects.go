@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+
+	"canvas/lib/styles"
+	"canvas/lib/utils"
+)
+
+// EffectsMeta turns on effects around the text, see styles.Effects. sizes
+// are pixels at 720p and scale with the canvas. an effect that's sent with
+// no sizes gets the defaults below.
+type EffectsMeta struct {
+	Outline *OutlineMeta `json:"outline"`
+	Shadow *ShadowMeta `json:"shadow"`
+	Glow *GlowMeta `json:"glow"`
+}
+
+type OutlineMeta struct {
+	Width float64 `json:"width"`
+	Color string `json:"color"`
+}
+
+type ShadowMeta struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+	Blur float64 `json:"blur"`
+	Color string `json:"color"`
+}
+
+type GlowMeta struct {
+	Radius float64 `json:"radius"`
+	Color string `json:"color"`
+}
+
+// the sizes effects get when the request leaves them out.
+const default_outline_width = 2;
+const default_shadow_offset = 3;
+const default_shadow_blur = 4;
+const default_glow_radius = 12;
+
+// effectColor parses c, leaving it nil when it's empty so the style picks.
+func effectColor(name, c string) (color.Color, error) {
+	if c == "" {
+		return nil, nil;
+	}
+	parsed, err := utils.ParseHexColor(c);
+	if err != nil {
+		return nil, fmt.Errorf("%s colour: %w", name, err);
+	}
+	return parsed, nil;
+}
+
+func (meta EffectsMeta) effects(scale float64) (styles.Effects, error) {
+	var e styles.Effects;
+	if o := meta.Outline; o != nil {
+		c, err := effectColor("outline", o.Color);
+		if err != nil {
+			return e, err;
+		}
+		width := o.Width;
+		if width == 0 {
+			width = default_outline_width;
+		}
+		e.Outline = &styles.Outline{ Width: width, Color: c };
+	}
+	if s := meta.Shadow; s != nil {
+		c, err := effectColor("shadow", s.Color);
+		if err != nil {
+			return e, err;
+		}
+		x, y, blur := s.X, s.Y, s.Blur;
+		if x == 0 && y == 0 && blur == 0 {
+			x, y, blur = default_shadow_offset, default_shadow_offset, default_shadow_blur;
+		}
+		e.Shadow = &styles.Shadow{ X: x, Y: y, Blur: blur, Color: c };
+	}
+	if g := meta.Glow; g != nil {
+		c, err := effectColor("glow", g.Color);
+		if err != nil {
+			return e, err;
+		}
+		radius := g.Radius;
+		if radius == 0 {
+			radius = default_glow_radius;
+		}
+		e.Glow = &styles.Glow{ Radius: radius, Color: c };
+	}
+	// the limits are checked at 720p, like the sizes are sent.
+	if err := e.Validate(); err != nil {
+		return e, err;
+	}
+	if e.Outline != nil {
+		e.Outline.Width *= scale;
+	}
+	if e.Shadow != nil {
+		e.Shadow.X, e.Shadow.Y, e.Shadow.Blur = e.Shadow.X * scale, e.Shadow.Y * scale, e.Shadow.Blur * scale;
+	}
+	if e.Glow != nil {
+		e.Glow.Radius *= scale;
+	}
+	return e, nil;
+}
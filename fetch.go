@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/gif"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// limits on the images a request makes us fetch: each one, and all of a
+// request's together, avatars and attachments alike.
+const fetch_timeout = 10 * time.Second;
+const max_image_bytes = 8 << 20;
+const max_request_bytes = 32 << 20;
+const max_batch_bytes = 128 << 20; // every distinct image of a batch
+const max_image_pixels = 4096 * 4096;
+const max_gif_pixels_total = 256 * 1024 * 1024; // every frame of a gif added up
+
+var fetch_client = &http.Client{ Timeout: fetch_timeout };
+
+// fetcher gets the images for one request, and keeps track of how much
+// it's fetched so far.
+type fetcher struct {
+	used int64
+	cache *fetchCache // shared with the rest of a batch, nil outside of one
+}
+
+// image gets the image at link, which is http(s), or a data url for images
+// sent with the request. an image from the cache still counts towards the
+// request's limit, as if it had been fetched for it.
+func (f *fetcher) image(link string) (*avatar, error) {
+	if f.cache != nil {
+		img, size, err := f.cache.image(link);
+		if err != nil {
+			return nil, err;
+		}
+		return img, f.count(size);
+	}
+	data, err := readImage(link);
+	if err != nil {
+		return nil, err;
+	}
+	if err := f.count(len(data)); err != nil {
+		return nil, err;
+	}
+	return decodeAvatar(data);
+}
+
+func (f *fetcher) count(size int) error {
+	f.used += int64(size);
+	if f.used > max_request_bytes {
+		return fmt.Errorf("the request's images add up to more than %d MiB", max_request_bytes >> 20);
+	}
+	return nil;
+}
+
+// fetchCache shares fetched images between the requests of a batch, so
+// each url is only fetched and decoded once, even when they ask for it at
+// the same time. the images are only ever read, so they can be shared.
+type fetchCache struct {
+	mu sync.Mutex
+	entries map[string]*cached
+	used int64
+}
+
+type cached struct {
+	done chan struct{} // closed once the image is in
+	img *avatar
+	size int
+	err error
+}
+
+func newFetchCache() *fetchCache {
+	return &fetchCache{ entries: map[string]*cached{} };
+}
+
+// image gets link once for the whole batch. the first to ask fetches it,
+// the others wait for it.
+func (c *fetchCache) image(link string) (*avatar, int, error) {
+	c.mu.Lock();
+	entry, ok := c.entries[link];
+	if !ok {
+		entry = &cached{ done: make(chan struct{}) };
+		c.entries[link] = entry;
+	}
+	c.mu.Unlock();
+	if ok {
+		<-entry.done;
+		return entry.img, entry.size, entry.err;
+	}
+	defer close(entry.done);
+
+	data, err := readImage(link);
+	if err == nil {
+		err = c.count(len(data));
+	}
+	if err == nil {
+		entry.img, err = decodeAvatar(data);
+	}
+	entry.size, entry.err = len(data), err;
+	return entry.img, entry.size, entry.err;
+}
+
+func (c *fetchCache) count(size int) error {
+	c.mu.Lock();
+	defer c.mu.Unlock();
+	c.used += int64(size);
+	if c.used > max_batch_bytes {
+		return fmt.Errorf("the batch's images add up to more than %d MiB", max_batch_bytes >> 20);
+	}
+	return nil;
+}
+
+// readImage reads the bytes of the image at link.
+func readImage(link string) ([]byte, error) {
+	if strings.HasPrefix(link, "data:") {
+		return readDataUrl(link);
+	}
+	u, err := url.Parse(link);
+	if err != nil {
+		return nil, err;
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported protocol scheme %q", u.Scheme);
+	}
+	resp, err := fetch_client.Get(link);
+	if err != nil {
+		return nil, err;
+	}
+	defer resp.Body.Close();
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("bad status: %s", resp.Status);
+	}
+	if resp.ContentLength > max_image_bytes {
+		return nil, fmt.Errorf("image is bigger than %d MiB", max_image_bytes >> 20);
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, max_image_bytes + 1));
+	if err != nil {
+		return nil, err;
+	}
+	if len(data) > max_image_bytes {
+		return nil, fmt.Errorf("image is bigger than %d MiB", max_image_bytes >> 20);
+	}
+	return data, nil;
+}
+
+// readDataUrl decodes a base64 data url, like data:image/png;base64,....
+func readDataUrl(link string) ([]byte, error) {
+	header, payload, ok := strings.Cut(strings.TrimPrefix(link, "data:"), ",");
+	if !ok || !strings.HasSuffix(header, ";base64") {
+		return nil, fmt.Errorf("data urls have to be base64");
+	}
+	if base64.StdEncoding.DecodedLen(len(payload)) > max_image_bytes + 2 {
+		return nil, fmt.Errorf("image is bigger than %d MiB", max_image_bytes >> 20);
+	}
+	data, err := base64.StdEncoding.DecodeString(payload);
+	if err != nil {
+		return nil, fmt.Errorf("data url: %w", err);
+	}
+	if len(data) > max_image_bytes {
+		return nil, fmt.Errorf("image is bigger than %d MiB", max_image_bytes >> 20);
+	}
+	return data, nil;
+}
+
+// decodeAvatar decodes an image, checking its size before it's unpacked.
+func decodeAvatar(data []byte) (*avatar, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data));
+	if err != nil {
+		return nil, err;
+	}
+	if config.Width * config.Height > max_image_pixels {
+		return nil, fmt.Errorf("image is %dx%d, it can have up to %d pixels", config.Width, config.Height, max_image_pixels);
+	}
+	if format == "gif" {
+		// frames are counted before any of them are unpacked.
+		if countGifFrames(data) * config.Width * config.Height > max_gif_pixels_total {
+			return nil, fmt.Errorf("gif has too many frames for its size");
+		}
+		frames, err := gif.DecodeAll(bytes.NewReader(data));
+		if err != nil {
+			return nil, err;
+		}
+		if len(frames.Image) > 1 {
+			return &avatar{ Frames: frames }, nil;
+		}
+	}
+	img, _, err := image.Decode(bytes.NewReader(data));
+	if err != nil {
+		return nil, err;
+	}
+	return &avatar{ Still: img }, nil;
+}
+
+// countGifFrames walks the blocks of a gif and counts its image
+// descriptors, skipping over colour tables, extensions and pixel data
+// without decoding any of it. a gif that's cut short is counted up to where
+// it ends, DecodeAll complains about it after.
+func countGifFrames(data []byte) int {
+	// the header and the logical screen descriptor.
+	at := 13;
+	if len(data) < at {
+		return 0;
+	}
+	at += colorTableSize(data[10]);
+	// subBlocks skips a run of data sub-blocks, up to the empty one ending it.
+	subBlocks := func() {
+		for at < len(data) && data[at] != 0 {
+			at += 1 + int(data[at]);
+		}
+		at++;
+	};
+	frames := 0;
+	for at < len(data) {
+		switch data[at] {
+		case 0x21: // an extension: its label, then sub-blocks.
+			at += 2;
+			subBlocks();
+		case 0x2c: // an image descriptor, its colour table, the lzw code size and the pixels.
+			if at + 10 > len(data) {
+				return frames;
+			}
+			frames++;
+			at += 10 + colorTableSize(data[at + 9]) + 1;
+			subBlocks();
+		default: // the trailer, or something DecodeAll won't take.
+			return frames;
+		}
+	}
+	return frames;
+}
+
+// colorTableSize is how many bytes of colour table a gif's packed field says
+// follow it.
+func colorTableSize(packed byte) int {
+	if packed & 0x80 == 0 {
+		return 0;
+	}
+	return 3 << ((packed & 7) + 1);
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"strings"
+	"testing"
+)
+
+// encodeGif is frames frames of w x h on a screen x screen canvas, every
+// other frame with its own palette.
+func encodeGif(t *testing.T, screen, w, h, frames int) []byte {
+	t.Helper();
+	src := &gif.GIF{ Config: image.Config{ Width: screen, Height: screen, ColorModel: color.Palette(palette.Plan9) } };
+	for i := 0; i < frames; i++ {
+		p := color.Palette(palette.Plan9);
+		if i % 2 == 1 {
+			p = color.Palette{ color.Black, color.White };
+		}
+		frame := image.NewPaletted(image.Rect(0, 0, w, h), p);
+		for j := range frame.Pix {
+			frame.Pix[j] = uint8((i + j) % len(p));
+		}
+		src.Image = append(src.Image, frame);
+		src.Delay = append(src.Delay, 5);
+	}
+	var buf bytes.Buffer;
+	if err := gif.EncodeAll(&buf, src); err != nil {
+		t.Fatal(err);
+	}
+	return buf.Bytes();
+}
+
+func TestCountGifFrames(t *testing.T) {
+	for _, n := range []int{ 1, 2, 7, 40 } {
+		data := encodeGif(t, 64, 64, 48, n);
+		if got := countGifFrames(data); got != n {
+			t.Errorf("a %d frame gif counted %d frames", n, got);
+		}
+		// a gif cut short counts what's there, and never more.
+		if got := countGifFrames(data[:len(data) / 2]); got > n {
+			t.Errorf("half of a %d frame gif counted %d frames", n, got);
+		}
+	}
+	if got := countGifFrames([]byte("GIF89a")); got != 0 {
+		t.Errorf("a bare header counted %d frames", got);
+	}
+}
+
+// a gif with many tiny frames on a big canvas is turned down before it's
+// decoded, since every frame is drawn on the whole canvas.
+func TestDecodeAvatarLimitsGifFrames(t *testing.T) {
+	data := encodeGif(t, 4096, 1, 1, max_gif_pixels_total / (4096 * 4096) + 1);
+	if _, err := decodeAvatar(data); err == nil || !strings.Contains(err.Error(), "too many frames") {
+		t.Errorf("decodeAvatar of a gif over the limit = %v, want too many frames", err);
+	}
+
+	a, err := decodeAvatar(encodeGif(t, 64, 64, 64, 3));
+	if err != nil {
+		t.Fatal(err);
+	}
+	if a.Frames == nil || len(a.Frames.Image) != 3 {
+		t.Errorf("a 3 frame gif didn't decode to 3 frames");
+	}
+}
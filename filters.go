@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/disintegration/gift"
+
+	"canvas/lib/filters"
+	"canvas/lib/utils"
+)
+
+// FilterMeta is a step of the avatar's filter chain. Amount is left out
+// to get the filter's default, and Dark and Light are duotone's colours.
+type FilterMeta struct {
+	Name string `json:"name"`
+	Amount *float64 `json:"amount"`
+	Dark string `json:"dark"`
+	Light string `json:"light"`
+}
+
+// what each style does to the avatar when the request has no filters.
+// an empty list in the request turns these off too.
+var default_filters = map[string][]FilterMeta{
+	style_classic: { { Name: "brightness" } },
+};
+
+// the most filters a chain can have. each one runs over every frame.
+const max_filters = 8;
+
+func (meta FilterMeta) filter() (filters.Filter, error) {
+	f := filters.Filter{
+		Name: strings.ToLower(meta.Name),
+		Dark: filters.DuotoneDark,
+		Light: filters.DuotoneLight,
+	};
+	f.Amount = filters.Defaults[f.Name];
+	if meta.Amount != nil {
+		f.Amount = *meta.Amount;
+	}
+	var err error;
+	if meta.Dark != "" {
+		if f.Dark, err = utils.ParseHexNRGBA(meta.Dark); err != nil {
+			return f, fmt.Errorf("%s dark: %w", f.Name, err);
+		}
+	}
+	if meta.Light != "" {
+		if f.Light, err = utils.ParseHexNRGBA(meta.Light); err != nil {
+			return f, fmt.Errorf("%s light: %w", f.Name, err);
+		}
+	}
+	return f, f.Validate();
+}
+
+// avatarFilters is the request's filter chain, or the style's default.
+func (meta *Meta) avatarFilters(style string, scale float64) ([]gift.Filter, error) {
+	metas := meta.Filters;
+	if metas == nil {
+		metas = default_filters[style];
+	}
+	if len(metas) > max_filters {
+		return nil, fmt.Errorf("a filter chain can have up to %d filters, got %d", max_filters, len(metas));
+	}
+	var chain []filters.Filter;
+	for i, m := range metas {
+		f, err := m.filter();
+		if err != nil {
+			return nil, fmt.Errorf("filter %d: %w", i, err);
+		}
+		chain = append(chain, f);
+	}
+	return filters.Chain(chain, scale), nil;
+}
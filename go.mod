@@ -9,3 +9,5 @@ require (
 )
 
 require github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0 // indirect
+
+require golang.org/x/text v0.16.0 // indirect
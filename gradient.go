@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+
+	"canvas/lib/utils"
+)
+
+// GradientMeta tweaks the classic style's fade. it starts out as the
+// default fade and the request only has to send the fields it changes.
+// left empty, From and To come from the theme's overlay colour.
+type GradientMeta struct {
+	Angle float64 `json:"angle"`
+	Start float64 `json:"start"`
+	Stop float64 `json:"stop"`
+	From string `json:"from"`
+	To string `json:"to"`
+	Curve string `json:"curve"`
+}
+
+func defaultGradientMeta() GradientMeta {
+	g := utils.ClassicGradient;
+	return GradientMeta{
+		Angle: g.Angle,
+		Start: g.Start,
+		Stop: g.Stop,
+		Curve: g.Curve,
+	};
+}
+
+// gradient fades from nothing into overlay, or into the default black
+// when overlay is nil. From and To in the request win over both.
+func (meta GradientMeta) gradient(overlay *color.NRGBA) (utils.Gradient, error) {
+	from, to := utils.ClassicGradient.From, utils.ClassicGradient.To;
+	if overlay != nil {
+		from, to = *overlay, *overlay;
+		from.A = 0;
+	}
+	var err error;
+	if meta.From != "" {
+		from, err = utils.ParseHexNRGBA(meta.From);
+		if err != nil {
+			return utils.Gradient{}, fmt.Errorf("gradient from: %w", err);
+		}
+	}
+	if meta.To != "" {
+		to, err = utils.ParseHexNRGBA(meta.To);
+		if err != nil {
+			return utils.Gradient{}, fmt.Errorf("gradient to: %w", err);
+		}
+	}
+	g := utils.Gradient{
+		Angle: meta.Angle,
+		Start: meta.Start,
+		Stop: meta.Stop,
+		From: from,
+		To: to,
+		Curve: meta.Curve,
+	};
+	return g, g.Validate();
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// jobs render quotes in the background, for renders that take longer than
+// a client wants to hold a request open for. they're only kept in memory.
+const (
+	job_queued = "queued"
+	job_running = "running"
+	job_done = "done"
+	job_failed = "failed"
+)
+
+// how callbacks are sent: a few tries, waiting longer each time.
+const callback_timeout = 10 * time.Second;
+const callback_tries = 3;
+
+// finished jobs are kept until they expire, or until there are too many of
+// them or their results add up to too much, and then the oldest go first.
+const max_finished_jobs = 1000;
+const max_finished_bytes = 512 << 20;
+
+// redirects aren't followed, they could lead anywhere.
+var callback_client = &http.Client{
+	Timeout: callback_timeout,
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse;
+	},
+};
+
+// JobMeta is a quote request sent to /jobs. CallbackUrl is told when it's
+// done, and has to start with one of the server's -callbacks.
+type JobMeta struct {
+	CallbackUrl string `json:"callback_url"`
+}
+
+// JobStatus is what /jobs/{id} says about a job, and what its callback gets.
+// Progress goes from 0 to 1, and only counts gif frames until it's done.
+type JobStatus struct {
+	Id string `json:"id"`
+	Status string `json:"status"`
+	Progress float64 `json:"progress"`
+	Frames int `json:"frames,omitempty"`
+	FramesDone int `json:"frames_done,omitempty"`
+	Error string `json:"error,omitempty"`
+	Code int `json:"code,omitempty"` // the http status a failed job would have had
+	ContentType string `json:"content_type,omitempty"`
+	Accent string `json:"accent,omitempty"`
+	Palette string `json:"palette,omitempty"`
+	StatusUrl string `json:"status_url"`
+	ResultUrl string `json:"result_url,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type job struct {
+	id string
+	meta Meta
+	callback string
+
+	mu sync.Mutex
+	state string
+	frames, frames_done int
+	rendered *Rendered
+	err error
+	expires time.Time // set once it's finished
+	size int // of its result, once it's done
+}
+
+// jobStore has every job that's waiting, running or finished and not yet
+// expired. queue holds the waiting ones, and is as long as the server lets
+// it be.
+type jobStore struct {
+	mu sync.Mutex
+	jobs map[string]*job
+	queue chan *job
+	finished []*job // in the order they finished, oldest first
+	finished_bytes int
+	ttl time.Duration
+	callbacks []*url.URL // where callbacks can go, see allowed
+}
+
+var jobs *jobStore;
+
+// startJobs makes the job store and starts runners to work through it. they
+// still wait for a worker, so jobs and other requests share them.
+func startJobs(queue_size int, ttl time.Duration, runners int, callbacks []*url.URL) {
+	jobs = &jobStore{
+		jobs: map[string]*job{},
+		queue: make(chan *job, max(1, queue_size)),
+		ttl: ttl,
+		callbacks: callbacks,
+	};
+	for i := 0; i < max(1, runners); i++ {
+		go jobs.run();
+	}
+	go jobs.expire();
+}
+
+func newJobId() string {
+	b := make([]byte, 16);
+	rand.Read(b);
+	return hex.EncodeToString(b);
+}
+
+// parseCallbacks reads the comma separated prefixes callbacks can go to.
+// each is an http(s) url with a host, and maybe a path.
+func parseCallbacks(list string) ([]*url.URL, error) {
+	var callbacks []*url.URL;
+	for _, prefix := range strings.Split(list, ",") {
+		if prefix == "" {
+			continue;
+		}
+		u, err := url.Parse(prefix);
+		if err != nil {
+			return nil, fmt.Errorf("callback prefix %q: %w", prefix, err);
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+			return nil, fmt.Errorf("callback prefix %q has to be an http(s) url with a host and at most a path", prefix);
+		}
+		callbacks = append(callbacks, u);
+	}
+	return callbacks, nil;
+}
+
+// allowed is whether callbacks can be sent to link: it has the scheme and
+// host of one of the server's callbacks, and a path under that one's. a
+// prefix's path ends at a /, so /hooks takes /hooks/a but not /hooksmith.
+func (s *jobStore) allowed(link string) error {
+	if len(s.callbacks) == 0 {
+		return fmt.Errorf("this server doesn't send callbacks");
+	}
+	u, err := url.Parse(link);
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("callback_url has to be an http(s) url");
+	}
+	if u.User != nil {
+		return fmt.Errorf("callback_url can't have a user name or password");
+	}
+	for _, segment := range strings.Split(u.Path, "/") {
+		if segment == "." || segment == ".." {
+			return fmt.Errorf("callback_url can't have . or .. in its path");
+		}
+	}
+	for _, prefix := range s.callbacks {
+		if u.Scheme == prefix.Scheme && strings.EqualFold(u.Host, prefix.Host) && underPath(u.EscapedPath(), prefix.EscapedPath()) {
+			return nil;
+		}
+	}
+	return fmt.Errorf("callbacks can't go to %s", link);
+}
+
+// underPath is whether path is prefix, or somewhere under it.
+func underPath(path, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/");
+	return path == prefix || strings.HasPrefix(path, prefix + "/");
+}
+
+// submit queues a job, failing when the queue is full.
+func (s *jobStore) submit(meta Meta, callback string) (*job, error) {
+	j := &job{ id: newJobId(), meta: meta, callback: callback, state: job_queued };
+	s.mu.Lock();
+	defer s.mu.Unlock();
+	select {
+	case s.queue <- j:
+		s.jobs[j.id] = j;
+		return j, nil;
+	default:
+		return nil, fmt.Errorf("the job queue is full, try again later");
+	}
+}
+
+func (s *jobStore) get(id string) *job {
+	s.mu.Lock();
+	defer s.mu.Unlock();
+	return s.jobs[id];
+}
+
+func (s *jobStore) run() {
+	for j := range s.queue {
+		j.mu.Lock();
+		j.state = job_running;
+		j.mu.Unlock();
+
+		rendered, err := renderLimited(&j.meta, nil, func(done, total int) {
+			j.mu.Lock();
+			j.frames_done, j.frames = done, total;
+			j.mu.Unlock();
+		});
+
+		j.mu.Lock();
+		j.rendered, j.err = rendered, err;
+		j.state = job_done;
+		if err != nil {
+			j.state = job_failed;
+		}
+		j.expires = time.Now().Add(s.ttl);
+		if rendered != nil {
+			j.size = len(rendered.Data);
+		}
+		status := j.statusLocked();
+		j.mu.Unlock();
+		s.finish(j);
+
+		if j.callback != "" {
+			go sendCallback(j.callback, status);
+		}
+	}
+}
+
+// finish keeps j to be polled, making room for it by dropping the oldest
+// finished jobs.
+func (s *jobStore) finish(j *job) {
+	s.mu.Lock();
+	defer s.mu.Unlock();
+	s.finished = append(s.finished, j);
+	s.finished_bytes += j.size;
+	for len(s.finished) > max_finished_jobs || s.finished_bytes > max_finished_bytes {
+		s.dropOldest();
+	}
+}
+
+// dropOldest forgets the job that finished first. s.mu has to be held.
+func (s *jobStore) dropOldest() {
+	j := s.finished[0];
+	s.finished[0] = nil;
+	s.finished = s.finished[1:];
+	s.finished_bytes -= j.size;
+	delete(s.jobs, j.id);
+}
+
+// expire drops finished jobs once they've been kept for the ttl. every job
+// is kept as long, so the ones to go are at the front.
+func (s *jobStore) expire() {
+	for range time.Tick(time.Minute) {
+		s.expireBefore(time.Now());
+	}
+}
+
+func (s *jobStore) expireBefore(now time.Time) {
+	s.mu.Lock();
+	defer s.mu.Unlock();
+	for len(s.finished) > 0 {
+		j := s.finished[0];
+		j.mu.Lock();
+		expired := now.After(j.expires);
+		j.mu.Unlock();
+		if !expired {
+			return;
+		}
+		s.dropOldest();
+	}
+}
+
+func (j *job) status() JobStatus {
+	j.mu.Lock();
+	defer j.mu.Unlock();
+	return j.statusLocked();
+}
+
+func (j *job) statusLocked() JobStatus {
+	s := JobStatus{
+		Id: j.id,
+		Status: j.state,
+		Frames: j.frames,
+		FramesDone: j.frames_done,
+		StatusUrl: "/jobs/" + j.id,
+	};
+	switch j.state {
+	case job_running:
+		// the last bit is encoding, after every frame is done.
+		if j.frames > 0 {
+			s.Progress = 0.99 * float64(j.frames_done) / float64(j.frames);
+		}
+	case job_done:
+		s.Progress = 1;
+		s.ContentType = j.rendered.ContentType;
+		s.ResultUrl = "/jobs/" + j.id + "/result";
+		if j.rendered.Palette != nil {
+			s.Palette = paletteHeader(j.rendered.Palette);
+		}
+		if j.rendered.Accent != nil {
+			s.Accent = hexColor(*j.rendered.Accent);
+		}
+	case job_failed:
+		s.Progress = 1;
+		s.Error, s.Code = j.err.Error(), statusOf(j.err);
+	}
+	if !j.expires.IsZero() {
+		expires := j.expires;
+		s.ExpiresAt = &expires;
+	}
+	return s;
+}
+
+// sendCallback posts status to link. it gives up after a few tries, the
+// job can still be polled.
+func sendCallback(link string, status JobStatus) {
+	body, _ := json.Marshal(status);
+	wait := time.Second;
+	for try := 1; try <= callback_tries; try++ {
+		resp, err := callback_client.Post(link, "application/json", bytes.NewReader(body));
+		if err == nil {
+			resp.Body.Close();
+			if resp.StatusCode < 300 {
+				return;
+			}
+			err = fmt.Errorf("bad status: %s", resp.Status);
+		}
+		log.Printf("job %s: callback %d of %d failed: %v", status.Id, try, callback_tries, err);
+		time.Sleep(wait);
+		wait *= 2;
+	}
+}
+
+func writeJson(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json");
+	w.WriteHeader(code);
+	json.NewEncoder(w).Encode(v);
+}
+
+// submitJob takes a quote request, the same as /quote's, and answers with
+// the job's status straight away.
+func submitJob(w http.ResponseWriter, r *http.Request) {
+	reqBody, ok := readBody(w, r, max_body_bytes);
+	if !ok {
+		return;
+	}
+	meta := Meta{ Gradient: defaultGradientMeta() };
+	var job_meta JobMeta;
+	if err := json.Unmarshal(reqBody, &meta); err != nil {
+		http.Error(w, "Failed to parse metadata.", http.StatusBadRequest);
+		return;
+	}
+	json.Unmarshal(reqBody, &job_meta);
+	if job_meta.CallbackUrl != "" {
+		if err := jobs.allowed(job_meta.CallbackUrl); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest);
+			return;
+		}
+	}
+	j, err := jobs.submit(meta, job_meta.CallbackUrl);
+	if err != nil {
+		w.Header().Set("Retry-After", "10");
+		http.Error(w, err.Error(), http.StatusServiceUnavailable);
+		return;
+	}
+	w.Header().Set("Location", "/jobs/" + j.id);
+	writeJson(w, http.StatusAccepted, j.status());
+}
+
+func jobStatus(w http.ResponseWriter, r *http.Request) {
+	j := jobs.get(r.PathValue("id"));
+	if j == nil {
+		http.Error(w, "no such job, or it expired", http.StatusNotFound);
+		return;
+	}
+	writeJson(w, http.StatusOK, j.status());
+}
+
+// jobResult sends a finished job's quote, or the error it failed with.
+func jobResult(w http.ResponseWriter, r *http.Request) {
+	j := jobs.get(r.PathValue("id"));
+	if j == nil {
+		http.Error(w, "no such job, or it expired", http.StatusNotFound);
+		return;
+	}
+	j.mu.Lock();
+	state, rendered, err := j.state, j.rendered, j.err;
+	j.mu.Unlock();
+	switch state {
+	case job_failed:
+		http.Error(w, err.Error(), statusOf(err));
+	case job_done:
+		sendRendered(w, rendered);
+	default:
+		http.Error(w, "the job isn't done yet", http.StatusConflict);
+	}
+}
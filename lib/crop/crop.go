@@ -0,0 +1,142 @@
+package crop
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strings"
+
+	"github.com/disintegration/gift"
+
+	"canvas/lib/stats"
+)
+
+// Crop picks which part of an image shows when it's cut down to fill a
+// panel of another shape.
+type Crop struct {
+	Strategy string // one of Strategies, empty is center
+	FocalX float64 // for focal, 0 to 1 across the image
+	FocalY float64 // and 0 to 1 down it
+}
+
+// Strategies are the ways a crop can be picked. center keeps the middle,
+// focal keeps the point the request gives, edges keeps the busiest part by
+// edge strength and entropy the part with the most varied detail.
+var Strategies = []string{ "center", "focal", "edges", "entropy" };
+
+func (c Crop) Validate() error {
+	switch c.Strategy {
+	case "", "center", "edges", "entropy":
+		return nil;
+	case "focal":
+		if c.FocalX < 0 || c.FocalX > 1 || c.FocalY < 0 || c.FocalY > 1 {
+			return fmt.Errorf("focal point has to be between 0 and 1, got %g, %g", c.FocalX, c.FocalY);
+		}
+		return nil;
+	}
+	return fmt.Errorf("unknown crop %q, have: %s", c.Strategy, strings.Join(Strategies, ", "));
+}
+
+// the saliency maps are worked out on a copy this big on its long side.
+const thumb_size = 96;
+
+// Focus is the point of img, as fractions of its width and height, that
+// should end up in the middle of the panel. visible_w and visible_h are how
+// much of img's width and height fit in the panel, from 0 to 1.
+func (c Crop) Focus(img image.Image, visible_w, visible_h float64) (float64, float64) {
+	switch c.Strategy {
+	case "focal":
+		return c.FocalX, c.FocalY;
+	case "edges":
+		return bestWindow(stats.EdgeMap(thumbnail(img)), visible_w, visible_h);
+	case "entropy":
+		return bestWindow(entropyMap(thumbnail(img)), visible_w, visible_h);
+	}
+	return 0.5, 0.5;
+}
+
+// thumbnail is img shrunk down and in grey, as rows of 0 to 255.
+func thumbnail(img image.Image) [][]float64 {
+	b := img.Bounds();
+	w, h := thumb_size, thumb_size;
+	if b.Dx() > b.Dy() {
+		h = max(1, thumb_size * b.Dy() / b.Dx());
+	} else {
+		w = max(1, thumb_size * b.Dx() / b.Dy());
+	}
+	g := gift.New(gift.Resize(w, h, gift.BoxResampling), gift.Grayscale());
+	small := image.NewGray(g.Bounds(b));
+	g.Draw(small, img);
+
+	rows := make([][]float64, h);
+	for y := range rows {
+		rows[y] = make([]float64, w);
+		for x := range rows[y] {
+			rows[y][x] = float64(small.GrayAt(small.Rect.Min.X + x, small.Rect.Min.Y + y).Y);
+		}
+	}
+	return rows;
+}
+
+// entropyMap is how varied the greys are around every pixel, as the
+// entropy of a 16 bin histogram of the 9x9 square around it.
+func entropyMap(grey [][]float64) [][]float64 {
+	const radius = 4;
+	h, w := len(grey), len(grey[0]);
+	energy := make([][]float64, h);
+	for y := range energy {
+		energy[y] = make([]float64, w);
+		for x := range energy[y] {
+			var bins [16]int;
+			n := 0;
+			for yy := max(0, y - radius); yy <= min(h - 1, y + radius); yy++ {
+				for xx := max(0, x - radius); xx <= min(w - 1, x + radius); xx++ {
+					bins[int(grey[yy][xx]) >> 4]++;
+					n++;
+				}
+			}
+			e := 0.0;
+			for _, count := range bins {
+				if count > 0 {
+					p := float64(count) / float64(n);
+					e -= p * math.Log2(p);
+				}
+			}
+			energy[y][x] = e;
+		}
+	}
+	return energy;
+}
+
+// bestWindow slides a window of the visible size over energy and returns
+// the middle of the one holding the most, preferring ones nearer the
+// middle of the image when they tie.
+func bestWindow(energy [][]float64, visible_w, visible_h float64) (float64, float64) {
+	h, w := len(energy), len(energy[0]);
+	win_w := min(w, max(1, int(math.Round(visible_w * float64(w)))));
+	win_h := min(h, max(1, int(math.Round(visible_h * float64(h)))));
+
+	// sums[y][x] is everything above and left of (x, y).
+	sums := make([][]float64, h + 1);
+	sums[0] = make([]float64, w + 1);
+	for y := 0; y < h; y++ {
+		sums[y+1] = make([]float64, w + 1);
+		for x := 0; x < w; x++ {
+			sums[y+1][x+1] = energy[y][x] + sums[y][x+1] + sums[y+1][x] - sums[y][x];
+		}
+	}
+
+	best_x, best_y := (w - win_w) / 2, (h - win_h) / 2;
+	best, best_dist := -1.0, 0.0;
+	for y := 0; y + win_h <= h; y++ {
+		for x := 0; x + win_w <= w; x++ {
+			total := sums[y + win_h][x + win_w] - sums[y][x + win_w] - sums[y + win_h][x] + sums[y][x];
+			dist := math.Hypot(float64(2 * x + win_w - w), float64(2 * y + win_h - h));
+			if total > best * 1.0001 || (total >= best && dist < best_dist) {
+				best, best_dist = total, dist;
+				best_x, best_y = x, y;
+			}
+		}
+	}
+	return (float64(best_x) + float64(win_w) / 2) / float64(w), (float64(best_y) + float64(win_h) / 2) / float64(h);
+}
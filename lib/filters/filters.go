@@ -0,0 +1,174 @@
+package filters
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/disintegration/gift"
+)
+
+// Filter is one step of an avatar's filter chain. What Amount means is up
+// to the filter, see Defaults. Dark and Light are only for duotone.
+type Filter struct {
+	Name string
+	Amount float64
+	Dark color.NRGBA
+	Light color.NRGBA
+}
+
+// Defaults is every filter by name, with the amount it gets when the
+// request doesn't say.
+var Defaults = map[string]float64{
+	"grayscale": 0, // no amount
+	"sepia": 100, // percent, 0 to 100
+	"brightness": -20, // percent, -100 to 100
+	"contrast": 20, // percent, -100 to 100
+	"saturation": 30, // percent, -100 to 500
+	"blur": 4, // gaussian sigma in pixels at 720p, 0 to 50
+	"vignette": 50, // how dark the corners get, 0 to 100
+	"grain": 15, // how strong the noise is, 0 to 100
+	"duotone": 100, // how much of the duotone is mixed in, 0 to 100
+};
+
+// the duotone's colours when the request doesn't give any.
+var DuotoneDark = color.NRGBA{ 0x1e, 0x1b, 0x4b, 255 };
+var DuotoneLight = color.NRGBA{ 0xf9, 0xc7, 0x4f, 255 };
+
+var ranges = map[string][2]float64{
+	"sepia": { 0, 100 },
+	"brightness": { -100, 100 },
+	"contrast": { -100, 100 },
+	"saturation": { -100, 500 },
+	"blur": { 0, 50 },
+	"vignette": { 0, 100 },
+	"grain": { 0, 100 },
+	"duotone": { 0, 100 },
+};
+
+// Names lists the filters, sorted.
+func Names() []string {
+	var names []string;
+	for name := range Defaults {
+		names = append(names, name);
+	}
+	sort.Strings(names);
+	return names;
+}
+
+func (f Filter) Validate() error {
+	if _, ok := Defaults[f.Name]; !ok {
+		return fmt.Errorf("unknown filter %q, have: %s", f.Name, strings.Join(Names(), ", "));
+	}
+	if r, ok := ranges[f.Name]; ok && (f.Amount < r[0] || f.Amount > r[1]) {
+		return fmt.Errorf("%s has to be between %g and %g, got %g", f.Name, r[0], r[1], f.Amount);
+	}
+	return nil;
+}
+
+// Chain turns filters into gift filters, in order. scale is the canvas's
+// size next to 720p, so blurs look the same at any size.
+func Chain(filters []Filter, scale float64) []gift.Filter {
+	var chain []gift.Filter;
+	for _, f := range filters {
+		amount := float32(f.Amount);
+		switch f.Name {
+		case "grayscale":
+			chain = append(chain, gift.Grayscale());
+		case "sepia":
+			chain = append(chain, gift.Sepia(amount));
+		case "brightness":
+			chain = append(chain, gift.Brightness(amount));
+		case "contrast":
+			chain = append(chain, gift.Contrast(amount));
+		case "saturation":
+			chain = append(chain, gift.Saturation(amount));
+		case "blur":
+			if f.Amount > 0 {
+				chain = append(chain, gift.GaussianBlur(float32(f.Amount * scale)));
+			}
+		case "vignette":
+			chain = append(chain, vignette(f.Amount / 100));
+		case "grain":
+			chain = append(chain, grain(f.Amount / 100));
+		case "duotone":
+			chain = append(chain, duotone(f.Dark, f.Light, f.Amount / 100));
+		}
+	}
+	return chain;
+}
+
+// duotone maps how bright each pixel is onto a ramp from dark to light.
+func duotone(dark, light color.NRGBA, mix float64) gift.Filter {
+	lerp := func(a, b uint8, t float32) float32 {
+		return (float32(a) + (float32(b) - float32(a)) * t) / 255;
+	};
+	m := float32(mix);
+	return gift.ColorFunc(func(r, g, b, a float32) (float32, float32, float32, float32) {
+		l := 0.299 * r + 0.587 * g + 0.114 * b;
+		return r + (lerp(dark.R, light.R, l) - r) * m,
+			g + (lerp(dark.G, light.G, l) - g) * m,
+			b + (lerp(dark.B, light.B, l) - b) * m,
+			a;
+	});
+}
+
+// pixelFilter runs fn over every pixel, knowing where the pixel is. gift's
+// ColorFunc only ever sees the colour.
+type pixelFilter func(x, y, width, height int, c *color.NRGBA)
+
+func (fn pixelFilter) Bounds(src image.Rectangle) image.Rectangle {
+	return image.Rectangle{ Max: src.Size() };
+}
+
+func (fn pixelFilter) Draw(dst draw.Image, src image.Image, options *gift.Options) {
+	b := src.Bounds();
+	img := image.NewNRGBA(image.Rectangle{ Max: b.Size() });
+	draw.Draw(img, img.Rect, src, b.Min, draw.Src);
+	w, h := b.Dx(), b.Dy();
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			i := img.PixOffset(x, y);
+			c := color.NRGBA{ img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] };
+			if c.A == 0 {
+				continue;
+			}
+			fn(x, y, w, h, &c);
+			img.Pix[i], img.Pix[i+1], img.Pix[i+2] = c.R, c.G, c.B;
+		}
+	}
+	draw.Draw(dst, dst.Bounds(), img, image.Point{}, draw.Src);
+}
+
+// vignette darkens towards the corners, starting a little way out from
+// the middle.
+func vignette(strength float64) gift.Filter {
+	return pixelFilter(func(x, y, width, height int, c *color.NRGBA) {
+		dx := (float64(x) + 0.5) / float64(width) * 2 - 1;
+		dy := (float64(y) + 0.5) / float64(height) * 2 - 1;
+		t := math.Min(1, math.Max(0, (math.Hypot(dx, dy) - 0.4) / (math.Sqrt2 - 0.4)));
+		k := 1 - strength * t * t;
+		c.R = uint8(float64(c.R) * k);
+		c.G = uint8(float64(c.G) * k);
+		c.B = uint8(float64(c.B) * k);
+	});
+}
+
+// grain adds grey noise. it's worked out from the pixel's position, so
+// every gif frame gets the same grain and it doesn't crawl.
+func grain(strength float64) gift.Filter {
+	return pixelFilter(func(x, y, width, height int, c *color.NRGBA) {
+		h := uint32(x) * 374761393 + uint32(y) * 668265263;
+		h = (h ^ (h >> 13)) * 1274126177;
+		h ^= h >> 16;
+		n := (float64(h & 0xffff) / 0xffff * 2 - 1) * strength * 64;
+		add := func(v uint8) uint8 {
+			return uint8(math.Min(255, math.Max(0, float64(v) + n)));
+		};
+		c.R, c.G, c.B = add(c.R), add(c.G), add(c.B);
+	});
+}
@@ -0,0 +1,239 @@
+package fonts
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+
+	"canvas/lib/layout"
+)
+
+// slots a font can fill in its family.
+const (
+	regular = iota
+	bold
+	italic
+	bold_italic
+	slot_count
+)
+
+// Family is every font that shares a family name.
+type Family struct {
+	Name string
+	fonts [slot_count]*opentype.Font
+	files [slot_count]string
+}
+
+// Registry holds every font parsed at startup, by family. It's read only
+// after NewRegistry returns, and parsed fonts are safe to share between
+// goroutines, so one registry serves every request.
+//
+// Faces are another story: opentype and truetype faces keep a glyph cache
+// and scratch buffers, and two requests drawing with one face at the same
+// time garble each other's glyphs. That's why the registry never hands out
+// a face directly, only FacesAt, which makes fresh ones.
+type Registry struct {
+	families map[string]*Family
+	mono *opentype.Font
+}
+
+// NewRegistry parses every .ttf and .otf file in dir. Any font that can't
+// be parsed is an error, and so is a directory without fonts, so a broken
+// deploy fails at startup rather than on the first request.
+func NewRegistry(fsys fs.FS, dir string) (*Registry, error) {
+	entries, err := fs.ReadDir(fsys, dir);
+	if err != nil {
+		return nil, fmt.Errorf("fonts: %w", err);
+	}
+
+	registry := &Registry{ families: map[string]*Family{} };
+	registry.mono, err = opentype.Parse(gomono.TTF);
+	if err != nil {
+		return nil, fmt.Errorf("fonts: go mono: %w", err);
+	}
+
+	for _, entry := range entries {
+		ext := strings.ToLower(path.Ext(entry.Name()));
+		if entry.IsDir() || (ext != ".ttf" && ext != ".otf") {
+			continue;
+		}
+		file := path.Join(dir, entry.Name());
+		if err := registry.add(fsys, file); err != nil {
+			return nil, fmt.Errorf("fonts: %s: %w", file, err);
+		}
+	}
+	if len(registry.families) == 0 {
+		return nil, fmt.Errorf("fonts: no .ttf or .otf files in %s", dir);
+	}
+	return registry, nil;
+}
+
+func (registry *Registry) add(fsys fs.FS, file string) error {
+	data, err := fs.ReadFile(fsys, file);
+	if err != nil {
+		return err;
+	}
+	f, err := opentype.Parse(data);
+	if err != nil {
+		return err;
+	}
+	// make sure it can actually draw something, some broken files parse fine.
+	if _, err := f.GlyphIndex(&sfnt.Buffer{}, 'a'); err != nil {
+		return err;
+	}
+
+	family, subfamily := fontNames(f);
+	if family == "" {
+		return fmt.Errorf("font has no family name");
+	}
+	key := strings.ToLower(family);
+	fam, ok := registry.families[key];
+	if !ok {
+		fam = &Family{ Name: family };
+		registry.families[key] = fam;
+	}
+
+	slot := slotOf(subfamily);
+	if fam.fonts[slot] != nil {
+		return fmt.Errorf("%s %s is already loaded from %s", family, subfamily, fam.files[slot]);
+	}
+	fam.fonts[slot] = f;
+	fam.files[slot] = file;
+	return nil;
+}
+
+// fontNames prefers the typographic names, which group all weights of a
+// family together, over the legacy ones that only know four styles.
+func fontNames(f *opentype.Font) (family string, subfamily string) {
+	var buf sfnt.Buffer;
+	family, err := f.Name(&buf, sfnt.NameIDTypographicFamily);
+	if err != nil || family == "" {
+		family, _ = f.Name(&buf, sfnt.NameIDFamily);
+	}
+	subfamily, err = f.Name(&buf, sfnt.NameIDTypographicSubfamily);
+	if err != nil || subfamily == "" {
+		subfamily, _ = f.Name(&buf, sfnt.NameIDSubfamily);
+	}
+	return family, subfamily;
+}
+
+func slotOf(subfamily string) int {
+	s := strings.ToLower(subfamily);
+	is_bold := strings.Contains(s, "bold") || strings.Contains(s, "black") || strings.Contains(s, "heavy");
+	is_italic := strings.Contains(s, "italic") || strings.Contains(s, "oblique");
+	switch {
+	case is_bold && is_italic:
+		return bold_italic;
+	case is_bold:
+		return bold;
+	case is_italic:
+		return italic;
+	}
+	return regular;
+}
+
+// Families lists the loaded family names, sorted.
+func (registry *Registry) Families() []string {
+	var names []string;
+	for _, fam := range registry.families {
+		names = append(names, fam.Name);
+	}
+	sort.Strings(names);
+	return names;
+}
+
+// Family looks a family up by name, ignoring case.
+func (registry *Registry) Family(name string) (*Family, error) {
+	fam, ok := registry.families[strings.ToLower(name)];
+	if !ok {
+		return nil, fmt.Errorf("unknown font %q, have: %s", name, strings.Join(registry.Families(), ", "));
+	}
+	return fam, nil;
+}
+
+// Require checks that every named family is loaded.
+func (registry *Registry) Require(names ...string) error {
+	for _, name := range names {
+		if _, err := registry.Family(name); err != nil {
+			return err;
+		}
+	}
+	return nil;
+}
+
+func newFace(f *opentype.Font, size float64) font.Face {
+	// the sizes come from parsed fonts that were already checked, so the
+	// only way this can fail is a nonsense size.
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{ Size: size, DPI: 72, Hinting: font.HintingNone });
+	if err != nil {
+		panic(err);
+	}
+	return face;
+}
+
+// pick returns the first font of the family that's there, in slot order.
+func (fam *Family) pick(slots ...int) *opentype.Font {
+	for _, slot := range slots {
+		if fam.fonts[slot] != nil {
+			return fam.fonts[slot];
+		}
+	}
+	return nil;
+}
+
+// FacesAt makes faces for fam at any size. The family's regular font is
+// Regular, falling back to whatever it has. Bold and italic are only set
+// when the family has them, so they get faked otherwise. With all_italic,
+// the italic fonts stand in for the upright ones, for text that's slanted
+// all the way through.
+//
+// The faces belong to whoever called FacesAt: call it once per render and
+// don't share the result between goroutines. Asking it for the same size
+// twice returns the same faces, which saves fitting and scaled spans from
+// rebuilding them over and over.
+func (registry *Registry) FacesAt(fam *Family, all_italic bool) layout.FacesAt {
+	regular_font := fam.pick(regular, bold, italic, bold_italic);
+	bold_font := fam.fonts[bold];
+	italic_font := fam.fonts[italic];
+	bold_italic_font := fam.fonts[bold_italic];
+	if all_italic {
+		regular_font = fam.pick(italic, regular, bold_italic, bold);
+		bold_font = bold_italic_font;
+	}
+	if bold_font == regular_font {
+		bold_font = nil;
+	}
+
+	made := map[float64]layout.Faces{};
+	var faces_at layout.FacesAt;
+	faces_at = func(size float64) layout.Faces {
+		if faces, ok := made[size]; ok {
+			return faces;
+		}
+		faces := layout.Faces{
+			Regular: newFace(regular_font, size),
+			Mono: newFace(registry.mono, size * 0.9),
+			Size: size,
+			At: faces_at,
+		};
+		if bold_font != nil {
+			faces.Bold = newFace(bold_font, size);
+		}
+		if italic_font != nil {
+			faces.Italic = newFace(italic_font, size);
+		}
+		if bold_italic_font != nil {
+			faces.BoldItalic = newFace(bold_italic_font, size);
+		}
+		made[size] = faces;
+		return faces;
+	};
+	return faces_at;
+}
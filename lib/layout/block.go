@@ -0,0 +1,77 @@
+package layout
+
+import (
+	"golang.org/x/image/font"
+)
+
+// LineBox is a line with its vertical metrics worked out. Everything is
+// in pixels, Top and Baseline are measured from the top of the block.
+type LineBox struct {
+	Line
+	Ascent float64 // tallest piece above the baseline
+	Descent float64 // deepest piece below the baseline
+	Height float64 // the face's line height, tallest piece wins
+	Advance float64 // from this line's top to the next one's
+	Top float64
+	Baseline float64
+}
+
+// Block is a stack of line boxes.
+type Block struct {
+	Lines []LineBox
+	Width float64 // of the widest line
+	Height float64 // from the top of the first line to the bottom of the last
+}
+
+func faceMetrics(face font.Face) (ascent, descent, height float64) {
+	m := face.Metrics();
+	return float64(m.Ascent) / 64, float64(m.Descent) / 64, float64(m.Height) / 64;
+}
+
+// NewBlock stacks lines on top of each other. Lines are as tall as their
+// tallest face, and never shorter than their glyphs, with the leading split
+// evenly above and below the glyphs. line_spacing stretches the gap between
+// lines but not the block's first or last line. Empty lines take their size
+// from faces.Regular.
+func NewBlock(lines []Line, faces Faces, line_spacing float64) Block {
+	var block Block;
+	top := 0.0;
+	for i, line := range lines {
+		box := LineBox{ Line: line };
+		if len(line.Pieces) == 0 {
+			box.Ascent, box.Descent, box.Height = faceMetrics(faces.Regular);
+		}
+		for _, piece := range line.Pieces {
+			ascent, descent, height := faceMetrics(piece.Face);
+			box.Ascent = max(box.Ascent, ascent);
+			box.Descent = max(box.Descent, descent);
+			box.Height = max(box.Height, height);
+		}
+		// some fonts have a line height smaller than their glyphs, their
+		// lines would overlap.
+		box.Height = max(box.Height, box.Ascent + box.Descent);
+
+		box.Top = top;
+		box.Baseline = top + box.Ascent + (box.Height - box.Ascent - box.Descent) / 2;
+		box.Advance = box.Height * line_spacing;
+		block.Width = max(block.Width, line.Width);
+		block.Lines = append(block.Lines, box);
+
+		if i == len(lines) - 1 {
+			block.Height = top + box.Height;
+		}
+		top += box.Advance;
+	}
+	return block;
+}
+
+// FitLines is how many of lines fit in height when stacked into a block.
+func FitLines(lines []Line, faces Faces, height float64, line_spacing float64) int {
+	block := NewBlock(lines, faces, line_spacing);
+	for i, box := range block.Lines {
+		if box.Top + box.Height > height {
+			return i;
+		}
+	}
+	return len(lines);
+}
@@ -0,0 +1,106 @@
+package layout
+
+import (
+	"testing"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+)
+
+// goFacesAt makes faces from the go fonts, the way the font registry does.
+func goFacesAt(t *testing.T) FacesAt {
+	t.Helper();
+	parse := func(data []byte) *opentype.Font {
+		f, err := opentype.Parse(data);
+		if err != nil {
+			t.Fatal(err);
+		}
+		return f;
+	};
+	regular, bold, italic := parse(goregular.TTF), parse(gobold.TTF), parse(goitalic.TTF);
+	face := func(f *opentype.Font, size float64) font.Face {
+		face, err := opentype.NewFace(f, &opentype.FaceOptions{ Size: size, DPI: 72, Hinting: font.HintingFull });
+		if err != nil {
+			t.Fatal(err);
+		}
+		return face;
+	};
+	var at FacesAt;
+	at = func(size float64) Faces {
+		return Faces{ Regular: face(regular, size), Bold: face(bold, size), Italic: face(italic, size), Size: size, At: at };
+	};
+	return at;
+}
+
+// line boxes never overlap, whatever the size, and mixing faces and scaled
+// runs on a line only makes it taller.
+func TestBlockLinesDontOverlap(t *testing.T) {
+	faces_at := goFacesAt(t);
+	runs := []Run{
+		{ Text: "The quick brown fox " },
+		{ Text: "jumps over", Style: Style{ Bold: true } },
+		{ Text: " the lazy dog, and then ", Style: Style{ Italic: true } },
+		{ Text: "BIG", Style: Style{ Scale: 1.8 } },
+		{ Text: " words and " },
+		{ Text: "small print", Style: Style{ Scale: 0.6 } },
+		{ Text: " follow.\n\nAfter an empty line, gjpqy descenders." },
+	};
+	for _, size := range []float64{ 8, 12, 17, 25, 33.5, 50, 72, 100, 144, 200 } {
+		for _, spacing := range []float64{ 1, 1.2, 1.5 } {
+			faces := faces_at(size);
+			lines := WrapRuns(runs, size * 12, faces);
+			if len(lines) < 3 {
+				t.Fatalf("size %g: want several lines to check, got %d", size, len(lines));
+			}
+			block := NewBlock(lines, faces, spacing);
+			for i, box := range block.Lines {
+				if box.Baseline - box.Ascent < box.Top - 0.001 || box.Baseline + box.Descent > box.Top + box.Height + 0.001 {
+					t.Errorf("size %g spacing %g line %d: glyphs stick out of the box: %+v", size, spacing, i, box);
+				}
+				if i == 0 {
+					continue;
+				}
+				previous := block.Lines[i-1];
+				if box.Top < previous.Top + previous.Height - 0.001 {
+					t.Errorf("size %g spacing %g line %d: top %g is above the previous line's bottom %g", size, spacing, i, box.Top, previous.Top + previous.Height);
+				}
+			}
+			last := block.Lines[len(block.Lines)-1];
+			if block.Height != last.Top + last.Height {
+				t.Errorf("size %g spacing %g: block is %g tall, its last line ends at %g", size, spacing, block.Height, last.Top + last.Height);
+			}
+		}
+	}
+}
+
+// a line with a scaled up run is as tall as that run's face.
+func TestBlockLineTakesTallestFace(t *testing.T) {
+	faces_at := goFacesAt(t);
+	for _, size := range []float64{ 10, 24, 60 } {
+		faces := faces_at(size);
+		plain := NewBlock(WrapRuns([]Run{ { Text: "plain" } }, 1e6, faces), faces, 1);
+		mixed := NewBlock(WrapRuns([]Run{ { Text: "plain " }, { Text: "big", Style: Style{ Scale: 2 } } }, 1e6, faces), faces, 1);
+		if mixed.Lines[0].Height <= plain.Lines[0].Height {
+			t.Errorf("size %g: a line with a 2x run is %g tall, a plain one %g", size, mixed.Lines[0].Height, plain.Lines[0].Height);
+		}
+	}
+}
+
+func TestFitLines(t *testing.T) {
+	faces := goFacesAt(t)(20);
+	lines := WrapRuns([]Run{ { Text: "one\ntwo\nthree\nfour" } }, 1e6, faces);
+	block := NewBlock(lines, faces, 1);
+	second_bottom := block.Lines[1].Top + block.Lines[1].Height;
+	if n := FitLines(lines, faces, second_bottom, 1); n != 2 {
+		t.Errorf("FitLines to the second line's bottom = %d, want 2", n);
+	}
+	if n := FitLines(lines, faces, second_bottom - 1, 1); n != 1 {
+		t.Errorf("FitLines to just above the second line's bottom = %d, want 1", n);
+	}
+	if n := FitLines(lines, faces, block.Height, 1); n != len(lines) {
+		t.Errorf("FitLines to the block's height = %d, want %d", n, len(lines));
+	}
+}
@@ -0,0 +1,62 @@
+package layout
+
+import (
+	"math"
+)
+
+const Ellipsis = "…"
+
+// Fitted is the result of fitting text into a box.
+type Fitted struct {
+	Faces Faces
+	Size float64
+	Lines []Line
+	Truncated bool
+}
+
+// Fit looks for the largest size between min_size and max_size where all of
+// runs fit in a width x height box. When even min_size overflows, the text
+// is cut at min_size and the last visible line ends in an ellipsis.
+func Fit(runs []Run, width, height float64, faces_at FacesAt, min_size, max_size, line_spacing float64) Fitted {
+	fits := func(size float64) (Faces, []Line, bool) {
+		faces := faces_at(size);
+		faces.Size, faces.At = size, faces_at;
+		lines := WrapRuns(runs, width, faces);
+		return faces, lines, NewBlock(lines, faces, line_spacing).Height <= height;
+	}
+
+	// search in half point steps, that's finer than anyone can tell apart.
+	lo, hi := int(math.Ceil(min_size * 2)), int(math.Floor(max_size * 2));
+	if hi < lo {
+		hi = lo;
+	}
+	faces, lines, ok := fits(float64(lo) / 2);
+	if !ok {
+		n := FitLines(lines, faces, height, line_spacing);
+		return Fitted{
+			Faces: faces,
+			Size: float64(lo) / 2,
+			Lines: TruncateLines(lines, n, width, faces),
+			Truncated: true,
+		};
+	}
+	best := Fitted{ Faces: faces, Size: float64(lo) / 2, Lines: lines };
+	for lo < hi {
+		mid := (lo + hi + 1) / 2;
+		if faces, lines, ok := fits(float64(mid) / 2); ok {
+			best = Fitted{ Faces: faces, Size: float64(mid) / 2, Lines: lines };
+			lo = mid;
+		} else {
+			hi = mid - 1;
+		}
+	}
+	return best;
+}
+
+func joinClusters(clusters []string) string {
+	s := "";
+	for _, c := range clusters {
+		s += c;
+	}
+	return s;
+}
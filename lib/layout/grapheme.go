@@ -0,0 +1,167 @@
+package layout
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// a trimmed down version of the UAX #29 grapheme cluster rules.
+// it covers what shows up in chat messages: combining marks, emoji
+// modifiers and ZWJ sequences, flags, hangul syllables and CRLF.
+type graphemeClass uint8
+
+const (
+	gcOther graphemeClass = iota
+	gcCR
+	gcLF
+	gcControl
+	gcExtend
+	gcZWJ
+	gcSpacingMark
+	gcRegionalIndicator
+	gcL
+	gcV
+	gcT
+	gcLV
+	gcLVT
+)
+
+const (
+	hangulSBase  = 0xAC00
+	hangulSCount = 11172
+	hangulTCount = 28
+)
+
+func graphemeClassOf(r rune) graphemeClass {
+	switch {
+	case r == '\r':
+		return gcCR
+	case r == '\n':
+		return gcLF
+	case r == 0x200D:
+		return gcZWJ
+	case r == 0x200C:
+		return gcExtend
+	case r >= 0x1F1E6 && r <= 0x1F1FF:
+		return gcRegionalIndicator
+	case r >= 0x1F3FB && r <= 0x1F3FF: // emoji skin tone modifiers
+		return gcExtend
+	case r >= 0xFE00 && r <= 0xFE0F, r >= 0xE0100 && r <= 0xE01EF: // variation selectors
+		return gcExtend
+	case r >= 0xE0020 && r <= 0xE007F: // emoji tag sequences
+		return gcExtend
+	case r >= 0x1100 && r <= 0x115F, r >= 0xA960 && r <= 0xA97C:
+		return gcL
+	case r >= 0x1160 && r <= 0x11A7, r >= 0xD7B0 && r <= 0xD7C6:
+		return gcV
+	case r >= 0x11A8 && r <= 0x11FF, r >= 0xD7CB && r <= 0xD7FB:
+		return gcT
+	case r >= hangulSBase && r < hangulSBase+hangulSCount:
+		if (r-hangulSBase)%hangulTCount == 0 {
+			return gcLV
+		}
+		return gcLVT
+	case unicode.Is(unicode.Mn, r), unicode.Is(unicode.Me, r):
+		return gcExtend
+	case unicode.Is(unicode.Mc, r):
+		return gcSpacingMark
+	case unicode.IsControl(r), r == 0x2028, r == 0x2029:
+		return gcControl
+	}
+	return gcOther
+}
+
+// isPictographic approximates the Extended_Pictographic property.
+func isPictographic(r rune) bool {
+	switch {
+	case r == 0x00A9, r == 0x00AE, r == 0x203C, r == 0x2049, r == 0x2122, r == 0x2139:
+		return true
+	case r >= 0x2194 && r <= 0x21AA:
+		return true
+	case r >= 0x231A && r <= 0x23FF:
+		return true
+	case r >= 0x24C2 && r <= 0x27BF:
+		return true
+	case r >= 0x2934 && r <= 0x2B55:
+		return true
+	case r == 0x3030, r == 0x303D, r == 0x3297, r == 0x3299:
+		return true
+	case r >= 0x1F000 && r <= 0x1FAFF && !(r >= 0x1F1E6 && r <= 0x1F1FF) && !(r >= 0x1F3FB && r <= 0x1F3FF):
+		return true
+	}
+	return false
+}
+
+// graphemeBreak reports whether there's a cluster boundary between prev and next.
+// riCount is the number of regional indicators directly before next, and
+// afterPictZWJ is true when prev is a ZWJ that follows a pictographic sequence.
+func graphemeBreak(prev, next rune, riCount int, afterPictZWJ bool) bool {
+	a, b := graphemeClassOf(prev), graphemeClassOf(next)
+	switch {
+	case a == gcCR && b == gcLF: // GB3
+		return false
+	case a == gcCR || a == gcLF || a == gcControl: // GB4
+		return true
+	case b == gcCR || b == gcLF || b == gcControl: // GB5
+		return true
+	case a == gcL && (b == gcL || b == gcV || b == gcLV || b == gcLVT): // GB6
+		return false
+	case (a == gcLV || a == gcV) && (b == gcV || b == gcT): // GB7
+		return false
+	case (a == gcLVT || a == gcT) && b == gcT: // GB8
+		return false
+	case b == gcExtend || b == gcZWJ || b == gcSpacingMark: // GB9, GB9a
+		return false
+	case a == gcZWJ && afterPictZWJ && isPictographic(next): // GB11
+		return false
+	case a == gcRegionalIndicator && b == gcRegionalIndicator: // GB12, GB13
+		return riCount%2 == 0
+	}
+	return true
+}
+
+// Graphemes splits s into user-perceived characters.
+func Graphemes(s string) []string {
+	var clusters []string;
+	start := 0;
+	prev := rune(-1);
+	riCount := 0;
+	inPict := false; // inside Pictographic Extend*
+	pictZWJ := false; // Pictographic Extend* ZWJ just seen
+
+	for i, r := range s {
+		if prev >= 0 && graphemeBreak(prev, r, riCount, pictZWJ) {
+			clusters = append(clusters, s[start:i]);
+			start = i;
+		}
+
+		class := graphemeClassOf(r);
+		if class == gcRegionalIndicator {
+			riCount++;
+		} else {
+			riCount = 0;
+		}
+		switch {
+		case isPictographic(r):
+			inPict, pictZWJ = true, false;
+		case class == gcExtend && inPict:
+			pictZWJ = false;
+		case class == gcZWJ && inPict:
+			pictZWJ = true;
+			inPict = false;
+		default:
+			inPict, pictZWJ = false, false;
+		}
+		prev = r;
+	}
+	if start < len(s) {
+		clusters = append(clusters, s[start:]);
+	}
+	return clusters
+}
+
+// firstRune returns the first rune of a cluster.
+func firstRune(s string) rune {
+	r, _ := utf8.DecodeRuneInString(s);
+	return r
+}
@@ -0,0 +1,76 @@
+package layout
+
+import (
+	"strings"
+)
+
+// Justify spreads the line's words out until it's width wide, by widening
+// the spaces between them. Pieces are split at the spaces so each word can
+// move on its own, and a stretched space stays part of the word before it,
+// so underlines and spoilers still cover it. Lines without spaces between
+// words, and lines that are already wider, come back as they are.
+func (line Line) Justify(width float64) Line {
+	extra := width - line.Width;
+	if extra <= 0 {
+		return line;
+	}
+
+	var words []Piece;
+	for _, piece := range line.Pieces {
+		measure := FaceMeasurer(piece.Face);
+		start := 0;
+		for start < len(piece.Text) {
+			end := wordEnd(piece.Text, start);
+			word := piece;
+			word.Text = piece.Text[start:end];
+			word.X = piece.X + measure(piece.Text[:start]);
+			word.Width = measure(word.Text);
+			words = append(words, word);
+			start = end;
+		}
+	}
+
+	// a gap is a word that ends in a space and has more words after it.
+	gaps := 0;
+	for i := range words[:max(0, len(words)-1)] {
+		if endsInSpace(words[i].Text) {
+			gaps++;
+		}
+	}
+	if gaps == 0 {
+		return line;
+	}
+
+	per_gap := extra / float64(gaps);
+	shift := 0.0;
+	for i := range words {
+		words[i].X += shift;
+		if i < len(words) - 1 && endsInSpace(words[i].Text) {
+			words[i].Width += per_gap;
+			shift += per_gap;
+		}
+	}
+	return Line{ Pieces: words, Width: width, Last: line.Last };
+}
+
+// wordEnd is where the word starting at start ends, after its spaces.
+func wordEnd(s string, start int) int {
+	in_space := false;
+	for i, r := range s[start:] {
+		space := isJustifySpace(r);
+		if in_space && !space {
+			return start + i;
+		}
+		in_space = in_space || space;
+	}
+	return len(s);
+}
+
+// only real spaces stretch, not tabs or the zero width ones.
+func isJustifySpace(r rune) bool {
+	return r == ' ' || r == '\u3000';
+}
+
+func endsInSpace(s string) bool {
+	return strings.TrimRightFunc(s, isJustifySpace) != s;
+}
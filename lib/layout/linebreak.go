@@ -0,0 +1,309 @@
+package layout
+
+import (
+	"unicode"
+)
+
+// line breaking classes from UAX #14.
+// classes that resolve to others under LB1 (AI, SG, XX, SA, CJ) are
+// folded in breakClassOf, so they never show up here.
+type breakClass uint8
+
+const (
+	lbAL breakClass = iota // alphabetic, the default
+	lbBK // mandatory break
+	lbCR
+	lbLF
+	lbNL
+	lbSP
+	lbZW // zero width space
+	lbWJ // word joiner
+	lbGL // non-breaking glue
+	lbCM // combining mark
+	lbZWJ
+	lbBA // break after
+	lbBB // break before
+	lbB2 // break on either side, but not between
+	lbHY // hyphen
+	lbCL // close punctuation
+	lbCP // close parenthesis
+	lbEX // exclamation / interrogation
+	lbIN // inseparable
+	lbIS // infix numeric separator
+	lbNS // non-starter
+	lbOP // open punctuation
+	lbQU // quotation
+	lbSY // symbols allowing break after
+	lbNU // numeric
+	lbPR // prefix numeric
+	lbPO // postfix numeric
+	lbHL // hebrew letter
+	lbID // ideographic
+	lbEB // emoji base
+	lbEM // emoji modifier
+	lbRI // regional indicator
+	lbH2 // hangul LV
+	lbH3 // hangul LVT
+	lbJL
+	lbJV
+	lbJT
+)
+
+// Break describes the opportunity at a boundary between two clusters.
+type Break uint8
+
+const (
+	NoBreak Break = iota
+	AllowedBreak
+	MandatoryBreak
+)
+
+func breakClassOf(r rune) breakClass {
+	switch r {
+	case '\n':
+		return lbLF
+	case '\r':
+		return lbCR
+	case 0x0085:
+		return lbNL
+	case 0x000B, 0x000C, 0x2028, 0x2029:
+		return lbBK
+	case ' ':
+		return lbSP
+	case 0x200B:
+		return lbZW
+	case 0x2060, 0xFEFF:
+		return lbWJ
+	case 0x00A0, 0x202F, 0x180E, 0x2007, 0x2011, 0x0F0C:
+		return lbGL
+	case 0x200D:
+		return lbZWJ
+	case '\t', 0x1680, 0x2000, 0x2001, 0x2002, 0x2003, 0x2004, 0x2005, 0x2006, 0x2008, 0x2009, 0x200A, 0x205F, 0x2010, 0x2012, 0x2013, 0x00AD, '|':
+		return lbBA
+	case 0x00B4, 0x02C8, 0x02CC, 0x02DF, 0x0F01, 0x0F02, 0x0F03, 0x0F04:
+		return lbBB
+	case 0x2014:
+		return lbB2
+	case '-':
+		return lbHY
+	case '}', ']', 0x3001, 0x3002, 0xFF0C, 0xFF0E, 0x300D, 0x300F, 0x3011, 0x3009, 0x300B, 0x3015, 0x3017, 0x3019, 0x301B, 0xFF5D, 0xFF3D, 0xFE50, 0xFE52, 0xFF61, 0xFF63, 0xFF64:
+		return lbCL
+	case ')', 0xFF09:
+		return lbCP
+	case '!', '?', 0xFF01, 0xFF1F, 0x05C6, 0x061F, 0x06D4:
+		return lbEX
+	case 0x2024, 0x2025, 0x2026, 0x22EF, 0xFE19:
+		return lbIN
+	case ',', '.', ':', ';', 0x037E, 0x0589, 0x060C, 0x060D, 0x07F8, 0x2044, 0xFE10, 0xFE13, 0xFE14:
+		return lbIS
+	case 0x203C, 0x203D, 0x2047, 0x2048, 0x2049, 0x301C, 0x30A0, 0x30FB, 0x30FC, 0x3005, 0x303B, 0x309B, 0x309C, 0x309D, 0x309E, 0x30FD, 0x30FE, 0xFF1A, 0xFF1B, 0xFF65, 0xFF70, 0xFF9E, 0xFF9F:
+		return lbNS
+	case '(', '[', '{', 0x00A1, 0x00BF, 0x3008, 0x300A, 0x300C, 0x300E, 0x3010, 0x3014, 0x3016, 0x3018, 0x301A, 0xFF08, 0xFF3B, 0xFF5B, 0xFF62, 0xFE59, 0xFE5B:
+		return lbOP
+	case '"', '\'', 0x00AB, 0x00BB, 0x2018, 0x2019, 0x201B, 0x201C, 0x201D, 0x201F, 0x2039, 0x203A, 0x275B, 0x275C, 0x275D, 0x275E:
+		return lbQU
+	case '/':
+		return lbSY
+	case '$', '+', '\\', 0x00B1, 0x2116, 0x2212, 0x2213, 0x20AC, 0x00A3, 0x00A5, 0xFFE1, 0xFFE5, 0xFF04:
+		return lbPR
+	case '%', 0x00A2, 0x00B0, 0x2030, 0x2031, 0x2032, 0x2033, 0x2034, 0x2035, 0x2036, 0x2037, 0x2103, 0x2109, 0xFF05, 0xFFE0:
+		return lbPO
+	}
+
+	switch {
+	case r >= 0x1F1E6 && r <= 0x1F1FF:
+		return lbRI
+	case r >= 0x1F3FB && r <= 0x1F3FF:
+		return lbEM
+	case r >= 0x1100 && r <= 0x115F, r >= 0xA960 && r <= 0xA97C:
+		return lbJL
+	case r >= 0x1160 && r <= 0x11A7, r >= 0xD7B0 && r <= 0xD7C6:
+		return lbJV
+	case r >= 0x11A8 && r <= 0x11FF, r >= 0xD7CB && r <= 0xD7FB:
+		return lbJT
+	case r >= hangulSBase && r < hangulSBase+hangulSCount:
+		if (r-hangulSBase)%hangulTCount == 0 {
+			return lbH2
+		}
+		return lbH3
+	// small kana and the prolonged sound mark are CJ, which LB1 resolves to NS
+	// in strict mode and ID otherwise. we go with the looser ID.
+	case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Bopomofo),
+		r >= 0x3000 && r <= 0x303F, r >= 0xFF01 && r <= 0xFF60, r >= 0xFFE0 && r <= 0xFFE6:
+		return lbID
+	case r >= 0x1F466 && r <= 0x1F469, r >= 0x1F3C2 && r <= 0x1F3CC, r >= 0x1F645 && r <= 0x1F64F, r >= 0x1F918 && r <= 0x1F91F, r == 0x261D, r == 0x26F9, r == 0x270A, r == 0x270B, r == 0x270C, r == 0x270D:
+		return lbEB
+	case isPictographic(r):
+		return lbID
+	case unicode.Is(unicode.Hebrew, r) && unicode.IsLetter(r):
+		return lbHL
+	case unicode.In(r, unicode.Mn, unicode.Mc, unicode.Me):
+		return lbCM
+	case unicode.IsControl(r):
+		return lbCM
+	case unicode.IsDigit(r):
+		return lbNU
+	}
+	// SA (thai, lao, khmer, myanmar) would need a dictionary. LB1 says
+	// to treat it as AL when there's none, and so do we.
+	return lbAL
+}
+
+// clusterClass resolves the class of a whole grapheme cluster (LB9, LB10).
+func clusterClass(cluster string) breakClass {
+	class := breakClassOf(firstRune(cluster));
+	if class == lbCM || class == lbZWJ {
+		return lbAL;
+	}
+	return class;
+}
+
+func isHangul(c breakClass) bool {
+	return c == lbJL || c == lbJV || c == lbJT || c == lbH2 || c == lbH3
+}
+
+func isAlpha(c breakClass) bool {
+	return c == lbAL || c == lbHL
+}
+
+// pairBreak applies the pair table of UAX #14 between the cluster classes
+// before and after a boundary. lastNonSpace is the class of the nearest
+// cluster before the boundary that isn't a space, and beforePrev is the
+// class of the cluster before prev.
+func pairBreak(beforePrev, prev, next, lastNonSpace breakClass) Break {
+	switch {
+	case prev == lbBK: // LB4
+		return MandatoryBreak
+	case prev == lbCR && next == lbLF: // LB5
+		return NoBreak
+	case prev == lbCR || prev == lbLF || prev == lbNL:
+		return MandatoryBreak
+	case next == lbBK || next == lbCR || next == lbLF || next == lbNL: // LB6
+		return NoBreak
+	case next == lbSP || next == lbZW: // LB7
+		return NoBreak
+	case lastNonSpace == lbZW: // LB8
+		return AllowedBreak
+	case prev == lbZWJ: // LB8a
+		return NoBreak
+	case prev == lbWJ || next == lbWJ: // LB11
+		return NoBreak
+	case prev == lbGL: // LB12
+		return NoBreak
+	case next == lbGL && prev != lbSP && prev != lbBA && prev != lbHY: // LB12a
+		return NoBreak
+	case next == lbCL || next == lbCP || next == lbEX || next == lbIS || next == lbSY: // LB13
+		return NoBreak
+	case lastNonSpace == lbOP: // LB14
+		return NoBreak
+	case lastNonSpace == lbQU && next == lbOP: // LB15
+		return NoBreak
+	case (lastNonSpace == lbCL || lastNonSpace == lbCP) && next == lbNS: // LB16
+		return NoBreak
+	case lastNonSpace == lbB2 && next == lbB2: // LB17
+		return NoBreak
+	case prev == lbSP: // LB18
+		return AllowedBreak
+	case prev == lbQU || next == lbQU: // LB19
+		return NoBreak
+	case next == lbBA || next == lbHY || next == lbNS || prev == lbBB: // LB21
+		return NoBreak
+	case beforePrev == lbHL && (prev == lbHY || prev == lbBA): // LB21a
+		return NoBreak
+	case prev == lbSY && next == lbHL: // LB21b
+		return NoBreak
+	case next == lbIN: // LB22
+		return NoBreak
+	case isAlpha(prev) && next == lbNU, prev == lbNU && isAlpha(next): // LB23
+		return NoBreak
+	case prev == lbPR && (next == lbID || next == lbEB || next == lbEM): // LB23a
+		return NoBreak
+	case (prev == lbID || prev == lbEB || prev == lbEM) && next == lbPO:
+		return NoBreak
+	case (prev == lbPR || prev == lbPO) && isAlpha(next), isAlpha(prev) && (next == lbPR || next == lbPO): // LB24
+		return NoBreak
+	case (prev == lbCL || prev == lbCP || prev == lbNU) && (next == lbPO || next == lbPR): // LB25
+		return NoBreak
+	case (prev == lbPO || prev == lbPR) && (next == lbOP || next == lbNU):
+		return NoBreak
+	case (prev == lbHY || prev == lbIS || prev == lbNU || prev == lbSY) && next == lbNU:
+		return NoBreak
+	case prev == lbJL && (next == lbJL || next == lbJV || next == lbH2 || next == lbH3): // LB26
+		return NoBreak
+	case (prev == lbJV || prev == lbH2) && (next == lbJV || next == lbJT):
+		return NoBreak
+	case (prev == lbJT || prev == lbH3) && next == lbJT:
+		return NoBreak
+	case isHangul(prev) && next == lbPO, prev == lbPR && isHangul(next): // LB27
+		return NoBreak
+	case isAlpha(prev) && isAlpha(next): // LB28
+		return NoBreak
+	case prev == lbIS && isAlpha(next): // LB29
+		return NoBreak
+	case (isAlpha(prev) || prev == lbNU) && next == lbOP, prev == lbCP && (isAlpha(next) || next == lbNU): // LB30
+		return NoBreak
+	case prev == lbEB && next == lbEM: // LB30b
+		return NoBreak
+	}
+	// LB30a is taken care of by the grapheme clusters, which already pair
+	// regional indicators up. everything else may break (LB31).
+	return AllowedBreak
+}
+
+// Segment is a piece of text that ends at a break opportunity.
+type Segment struct {
+	Text string
+	Clusters []string
+	Break Break // the opportunity at the end of the segment
+}
+
+// Segments splits s at every UAX #14 line break opportunity. Spaces stay
+// attached to the end of the segment before them, and a mandatory break
+// character stays attached to the segment it ends.
+func Segments(s string) []Segment {
+	clusters := Graphemes(s);
+	if len(clusters) == 0 {
+		return nil;
+	}
+
+	var segments []Segment;
+	start := 0;
+	offset := 0;
+	segStart := 0;
+	beforePrev := lbAL;
+	prev := clusterClass(clusters[0]);
+	lastNonSpace := prev;
+	if prev == lbSP {
+		// LB2-ish: a leading run of spaces behaves like it follows a word joiner.
+		lastNonSpace = lbWJ;
+	}
+
+	for i := 1; i < len(clusters); i++ {
+		offset += len(clusters[i-1]);
+		next := clusterClass(clusters[i]);
+
+		opportunity := pairBreak(beforePrev, prev, next, lastNonSpace);
+		if opportunity != NoBreak {
+			segments = append(segments, Segment{
+				Text: s[segStart:offset],
+				Clusters: clusters[start:i],
+				Break: opportunity,
+			});
+			segStart = offset;
+			start = i;
+		}
+
+		beforePrev = prev;
+		prev = next;
+		if next != lbSP {
+			lastNonSpace = next;
+		}
+	}
+	// LB3: always break at the end of text.
+	segments = append(segments, Segment{
+		Text: s[segStart:],
+		Clusters: clusters[start:],
+		Break: MandatoryBreak,
+	});
+	return segments;
+}
@@ -0,0 +1,111 @@
+package layout
+
+import (
+	"reflect"
+	"testing"
+)
+
+// clusterWidth measures every grapheme cluster as 1 wide, so widths in the
+// tests are counts of user-perceived characters.
+func clusterWidth(s string) float64 {
+	return float64(len(Graphemes(s)));
+}
+
+func TestGraphemes(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{ "ascii", "abc", []string{ "a", "b", "c" } },
+		{ "combining mark", "éx", []string{ "é", "x" } },
+		{ "crlf", "a\r\nb", []string{ "a", "\r\n", "b" } },
+		{ "cjk", "日本語", []string{ "日", "本", "語" } },
+		{ "zwj family", "a👨‍👩‍👧b", []string{ "a", "👨‍👩‍👧", "b" } },
+		{ "skin tone", "👍🏽!", []string{ "👍🏽", "!" } },
+		{ "flags pair up", "🇯🇵🇺🇸🇫", []string{ "🇯🇵", "🇺🇸", "🇫" } },
+		{ "empty", "", nil },
+	};
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := Graphemes(test.text);
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Graphemes(%q) = %q, want %q", test.text, got, test.want);
+			}
+		});
+	}
+}
+
+func TestSegments(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{ "words keep their spaces", "hello big world", []string{ "hello ", "big ", "world" } },
+		{ "cjk breaks between ideographs", "日本語のテキスト", []string{ "日", "本", "語", "の", "テ", "キ", "ス", "ト" } },
+		{ "no break before closing punctuation", "こんにちは、世界。", []string{ "こ", "ん", "に", "ち", "は、", "世", "界。" } },
+		{ "no break inside brackets", "(日本)", []string{ "(日", "本)" } },
+		{ "url breaks after slashes", "https://example.com/a/b", []string{ "https://", "example.com/", "a/", "b" } },
+		{ "mixed latin and cjk", "Hello 世界 and 你好", []string{ "Hello ", "世", "界 ", "and ", "你", "好" } },
+		{ "zwj sequence stays whole", "a 👨‍👩‍👧 b", []string{ "a ", "👨‍👩‍👧 ", "b" } },
+		{ "newline is mandatory", "line\nbreak", []string{ "line\n", "break" } },
+	};
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got []string;
+			for _, segment := range Segments(test.text) {
+				got = append(got, segment.Text);
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Segments(%q) = %q, want %q", test.text, got, test.want);
+			}
+		});
+	}
+}
+
+func TestSegmentBreaks(t *testing.T) {
+	segments := Segments("a\nb c");
+	want := []Break{ MandatoryBreak, AllowedBreak, MandatoryBreak };
+	if len(segments) != len(want) {
+		t.Fatalf("got %d segments, want %d", len(segments), len(want));
+	}
+	for i, segment := range segments {
+		if segment.Break != want[i] {
+			t.Errorf("segment %d (%q) ends with break %d, want %d", i, segment.Text, segment.Break, want[i]);
+		}
+	}
+}
+
+func TestWrap(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		width float64
+		want []string
+	}{
+		{ "fits", "short", 8, []string{ "short" } },
+		{ "words", "the quick brown fox", 10, []string{ "the quick", "brown fox" } },
+		{ "cjk without spaces", "日本語のテキストです", 4, []string{ "日本語の", "テキスト", "です" } },
+		{ "cjk punctuation stays with its character", "こんにちは、世界。", 5, []string{ "こんにち", "は、世界。" } },
+		{ "long url", "see https://example.com/a/very/long/path now", 12, []string{ "see https://", "example.com/", "a/very/long/", "path now" } },
+		{ "overlong token is forced", "aaaaaaaaaaaaaaaaaaaa", 8, []string{ "aaaaaaaa", "aaaaaaaa", "aaaa" } },
+		{ "mixed latin and cjk", "Hello 世界 and 你好 friends", 8, []string{ "Hello 世界", "and 你好", "friends" } },
+		{ "forced breaks keep zwj sequences", "👨‍👩‍👧👨‍👩‍👧👨‍👩‍👧", 2, []string{ "👨‍👩‍👧👨‍👩‍👧", "👨‍👩‍👧" } },
+		{ "forced breaks keep combining marks", "ééééé", 2, []string{ "éé", "éé", "é" } },
+		{ "newline", "one\ntwo", 20, []string{ "one", "two" } },
+	};
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := Wrap(test.text, test.width, clusterWidth);
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Wrap(%q, %g) = %q, want %q", test.text, test.width, got, test.want);
+			}
+			for _, line := range got {
+				if clusterWidth(line) > test.width {
+					t.Errorf("line %q is wider than %g", line, test.width);
+				}
+			}
+		});
+	}
+}
@@ -0,0 +1,307 @@
+package layout
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// the inline markdown discord understands. the rules follow simple-markdown,
+// which is what the discord client is built on: a marker character doubled
+// is one style and on its own another, and ~ and | only count doubled.
+const (
+	md_italic = iota
+	md_bold
+	md_underline
+	md_strike
+	md_spoiler
+	md_styles
+)
+
+const markdown_markers = "*_~|";
+const markdown_escapable = "\\*_~`|>#-"
+
+// mdStyle is the style a marker starts when count of it are used.
+func mdStyle(marker byte, count int) int {
+	switch {
+	case marker == '~':
+		return md_strike;
+	case marker == '|':
+		return md_spoiler;
+	case count == 1:
+		return md_italic;
+	case marker == '*':
+		return md_bold;
+	}
+	return md_underline;
+}
+
+// mdItem is a piece of the parsed text: plain text, a code span, or a run of
+// one marker character.
+type mdItem struct {
+	text string
+	code bool
+	marker byte // 0 for text and code
+	count int // how much of the run isn't used by a match yet
+	single_open, single_close bool // whether one of it can start or end italics
+	on, off [md_styles]int // styles matches start after the run, or end before it
+}
+
+// mdParser parses in one pass. code spans are matched as they're found, and
+// runs of markers wait on a stack for something to close them, each closer
+// taking the nearest opener that fits it, like commonmark's delimiter stack.
+type mdParser struct {
+	s string
+	items []mdItem
+	text strings.Builder
+	stack []int // items that can still open
+	// how far down the stack a closer can look. a closer that found nothing
+	// stops the next one like it from looking at the same openers again.
+	bottom [len(markdown_markers) * 4]int
+	triple, single nextIndex // the next ``` and `
+}
+
+// ParseMarkdown splits discord flavoured markdown into styled runs. Markup
+// that isn't closed is kept as literal text, like the client does.
+func ParseMarkdown(s string) []Run {
+	p := &mdParser{ s: s, triple: nextIndex{ s: s, sub: "```" }, single: nextIndex{ s: s, sub: "`" } };
+	for i := 0; i < len(s); {
+		c := s[i];
+		switch {
+		case c == '\\' && i + 1 < len(s) && strings.IndexByte(markdown_escapable, s[i+1]) >= 0:
+			p.text.WriteByte(s[i+1]);
+			i += 2;
+		case c == '`':
+			i = p.code(i);
+		case strings.IndexByte(markdown_markers, c) >= 0:
+			end := i;
+			for end < len(s) && s[end] == c {
+				end++;
+			}
+			p.marker(i, end);
+			i = end;
+		default:
+			p.text.WriteByte(c);
+			i++;
+		}
+	}
+	p.flush();
+	return p.runs();
+}
+
+// flush ends the plain text so far.
+func (p *mdParser) flush() {
+	if p.text.Len() > 0 {
+		p.items = append(p.items, mdItem{ text: p.text.String() });
+		p.text.Reset();
+	}
+}
+
+// code takes the code span starting at i, or the backtick as text when
+// nothing closes it, and returns where to carry on. spans can't be empty.
+func (p *mdParser) code(i int) int {
+	if strings.HasPrefix(p.s[i:], "```") {
+		if end := p.triple.from(i + 4); end >= 0 {
+			p.flush();
+			p.items = append(p.items, mdItem{ text: codeText(p.s[i+3:end], "```"), code: true });
+			return end + 3;
+		}
+	}
+	if end := p.single.from(i + 2); end >= 0 {
+		p.flush();
+		p.items = append(p.items, mdItem{ text: p.s[i+1:end], code: true });
+		return end + 1;
+	}
+	p.text.WriteByte('`');
+	return i + 1;
+}
+
+// marker adds the run of markers from start to end, closing what it can
+// and then waiting to open with what's left.
+func (p *mdParser) marker(start, end int) {
+	s := p.s;
+	item := mdItem{ text: s[start:end], marker: s[start], count: end - start };
+	before, _ := utf8.DecodeLastRuneInString(s[:start]);
+	after, _ := utf8.DecodeRuneInString(s[end:]);
+	switch item.marker {
+	case '*':
+		// *text* needs something other than a space inside both stars.
+		item.single_open = end < len(s) && !unicode.IsSpace(after);
+		item.single_close = start > 0 && !unicode.IsSpace(before);
+	case '_':
+		// snake_case_words aren't italic.
+		item.single_open = start == 0 || !isWordRune(before);
+		item.single_close = end == len(s) || !isWordRune(after);
+	}
+	p.flush();
+	p.items = append(p.items, item);
+	k := len(p.items) - 1;
+	p.close(k);
+	if left := p.items[k]; left.count >= 2 || (left.count == 1 && left.single_open) {
+		p.stack = append(p.stack, k);
+	}
+}
+
+// close matches the run at k with openers on the stack until it's used up
+// or nothing fits.
+func (p *mdParser) close(k int) {
+	closer := &p.items[k];
+	for closer.count > 0 {
+		key := strings.IndexByte(markdown_markers, closer.marker) * 4;
+		if closer.count >= 2 {
+			key += 2;
+		}
+		if closer.single_close {
+			key++;
+		}
+		found, use := -1, 0;
+		for at := len(p.stack) - 1; at >= p.bottom[key]; at-- {
+			if use = mdUse(&p.items[p.stack[at]], closer); use > 0 {
+				found = at;
+				break;
+			}
+		}
+		if found < 0 {
+			p.bottom[key] = len(p.stack);
+			return;
+		}
+
+		opener := &p.items[p.stack[found]];
+		opener.count -= use;
+		closer.count -= use;
+		opener.on[mdStyle(closer.marker, use)]++;
+		closer.off[mdStyle(closer.marker, use)]++;
+		// markers between the two can't be matched any more, they stay text.
+		height := found + 1;
+		if opener.count == 0 {
+			height = found;
+		}
+		p.stack = p.stack[:height];
+		for i := range p.bottom {
+			p.bottom[i] = min(p.bottom[i], height);
+		}
+	}
+}
+
+// mdUse is how many markers opener and closer can match with, 0 when they
+// can't. a pair of doubled ones always can, single ones need text on the
+// inside of both.
+func mdUse(opener, closer *mdItem) int {
+	switch {
+	case opener.marker != closer.marker:
+		return 0;
+	case opener.count >= 2 && closer.count >= 2:
+		return 2;
+	case (opener.marker == '*' || opener.marker == '_') && opener.single_open && closer.single_close:
+		return 1;
+	}
+	return 0;
+}
+
+// runs turns the items into styled runs. markers that weren't used stay as
+// text, outside the styles they start or end.
+func (p *mdParser) runs() []Run {
+	var depth [md_styles]int;
+	var out runWriter;
+	style := func() Style {
+		return Style{
+			Italic: depth[md_italic] > 0,
+			Bold: depth[md_bold] > 0,
+			Underline: depth[md_underline] > 0,
+			Strike: depth[md_strike] > 0,
+			Spoiler: depth[md_spoiler] > 0,
+		};
+	};
+	for _, item := range p.items {
+		switch {
+		case item.code:
+			code := style();
+			code.Code = true;
+			out.write(item.text, code);
+		case item.marker == 0:
+			out.write(item.text, style());
+		default:
+			for i, n := range item.off {
+				depth[i] -= n;
+			}
+			out.write(item.text[:item.count], style());
+			for i, n := range item.on {
+				depth[i] += n;
+			}
+		}
+	}
+	return out.done();
+}
+
+// runWriter builds runs, joining text with the same style as the run
+// before it.
+type runWriter struct {
+	runs []Run
+	text strings.Builder
+	style Style
+}
+
+func (w *runWriter) write(text string, style Style) {
+	if text == "" {
+		return;
+	}
+	if w.text.Len() > 0 && style != w.style {
+		w.end();
+	}
+	w.style = style;
+	w.text.WriteString(text);
+}
+
+func (w *runWriter) end() {
+	w.runs = append(w.runs, Run{ Text: w.text.String(), Style: w.style });
+	w.text.Reset();
+}
+
+func (w *runWriter) done() []Run {
+	if w.text.Len() > 0 {
+		w.end();
+	}
+	return w.runs;
+}
+
+// nextIndex finds sub in s from positions that only ever move forward,
+// keeping the last find so s is only searched through about once.
+type nextIndex struct {
+	s, sub string
+	searched bool
+	start, at int // the first sub at or after start is at, len(s) for none
+}
+
+// from is the first sub at or after i, or -1.
+func (n *nextIndex) from(i int) int {
+	if !n.searched || i < n.start || i > n.at {
+		n.searched, n.start, n.at = true, i, len(n.s);
+		if i <= len(n.s) {
+			if found := strings.Index(n.s[i:], n.sub); found >= 0 {
+				n.at = i + found;
+			}
+		}
+	}
+	if n.at >= len(n.s) {
+		return -1;
+	}
+	return n.at;
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r);
+}
+
+// codeText drops the language tag and the newlines around a code block.
+func codeText(s string, token string) string {
+	if token != "```" {
+		return s;
+	}
+	if newline := strings.IndexByte(s, '\n'); newline >= 0 {
+		lang := s[:newline];
+		if lang != "" && !strings.ContainsAny(lang, " \t`") {
+			s = s[newline+1:];
+		}
+	}
+	return strings.Trim(s, "\n");
+}
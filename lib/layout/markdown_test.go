@@ -0,0 +1,98 @@
+package layout
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// describe writes runs as text:flags, flags being letters for italic, bold,
+// underline, strike, code and spoiler.
+func describe(runs []Run) string {
+	parts := []string{};
+	for _, r := range runs {
+		flags := "";
+		for i, on := range []bool{ r.Style.Italic, r.Style.Bold, r.Style.Underline, r.Style.Strike, r.Style.Code, r.Style.Spoiler } {
+			if on {
+				flags += string("ibuscp"[i]);
+			}
+		}
+		parts = append(parts, r.Text + ":" + flags);
+	}
+	return strings.Join(parts, " | ");
+}
+
+func TestParseMarkdown(t *testing.T) {
+	cases := []struct{ in, want string }{
+		{ "plain", "plain:" },
+		{ "*it*", "it:i" },
+		{ "_it_", "it:i" },
+		{ "**b**", "b:b" },
+		{ "__u__", "u:u" },
+		{ "~~s~~", "s:s" },
+		{ "||sp||", "sp:p" },
+
+		// nesting
+		{ "***bi***", "bi:ib" },
+		{ "___ui___", "ui:iu" },
+		{ "**b *i* b**", "b :b | i:ib |  b:b" },
+		{ "*i **b** i*", "i :i | b:ib |  i:i" },
+		{ "~~**bs**~~", "bs:bs" },
+		{ "||*x*||", "x:ip" },
+		{ "***a** b*", "a:ib |  b:i" },
+		{ "**bold** and *it*", "bold:b |  and : | it:i" },
+
+		// markers that can't open or close stay text
+		{ "* not *", "* not *:" },
+		{ "2 * 3 * 4", "2 * 3 * 4:" },
+		{ "snake_case_word", "snake_case_word:" },
+		{ "__init__", "init:u" },
+		{ "foo*bar*baz", "foo: | bar:i | baz:" },
+		{ "** a **", " a :b" },
+		{ "~a~", "~a~:" },
+
+		// unclosed markers
+		{ "*unclosed", "*unclosed:" },
+		{ "**unclosed", "**unclosed:" },
+		{ "~~a", "~~a:" },
+		{ "||a", "||a:" },
+		{ "a*", "a*:" },
+		{ "****", "****:" },
+		{ "||||", "||||:" },
+		{ "~~~a~~~", "~: | a:s | ~:" },
+
+		// escapes
+		{ "\\*no\\*", "*no*:" },
+		{ "*a\\*b*", "a*b:i" },
+		{ "\\\\*i*", "\\: | i:i" },
+		{ "a\\b", "a\\b:" },
+
+		// code spans
+		{ "`c`", "c:c" },
+		{ "```go\nx := 1\n```", "x := 1:c" },
+		{ "`\\*`", "\\*:c" },
+		{ "`a*b`*c*", "a*b:c | c:i" },
+		{ "*`code*`", "*: | code*:c" },
+		{ "**`x`**", "x:bc" },
+		{ "`a", "`a:" },
+		{ "``", "``:" },
+	};
+	for _, c := range cases {
+		if got := describe(ParseMarkdown(c.in)); got != c.want {
+			t.Errorf("%q: got %q, want %q", c.in, got, c.want);
+		}
+	}
+}
+
+// markers that never close used to be searched for again from each one, so
+// long text full of them took quadratic time.
+func TestParseMarkdownLinear(t *testing.T) {
+	for _, unit := range []string{ "*a ", "**a ", "_a ", "~~a ", "`a ", "```a ", "*a _b ~~c " } {
+		text := strings.Repeat(unit, 40000);
+		start := time.Now();
+		ParseMarkdown(text);
+		if took := time.Since(start); took > time.Second {
+			t.Errorf("%q: took %v", unit, took);
+		}
+	}
+}
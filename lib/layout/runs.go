@@ -0,0 +1,214 @@
+package layout
+
+import (
+	"image/color"
+	"sort"
+	"strings"
+
+	"golang.org/x/image/font"
+)
+
+// Style is the formatting of a run of text.
+type Style struct {
+	Bold bool
+	Italic bool
+	Underline bool
+	Strike bool
+	Code bool
+	Spoiler bool
+	Color color.Color // nil draws in the block's colour
+	Scale float64 // size relative to the block, 0 means 1
+}
+
+// Run is a piece of text that shares one style.
+type Run struct {
+	Text string
+	Style Style
+}
+
+// Faces holds the faces a block of text can be drawn with. Only Regular is
+// required, the rest fall back to it and get faked by the renderer (see
+// Faces.For). Runs with a Scale need At and Size to get faces of another
+// size, without them they're drawn at the block's size.
+type Faces struct {
+	Regular font.Face
+	Bold font.Face
+	Italic font.Face
+	BoldItalic font.Face
+	Mono font.Face
+
+	Size float64
+	At FacesAt
+}
+
+// FacesAt makes a set of faces at the given size.
+type FacesAt func(size float64) Faces
+
+// For returns the face for a style, and whether bold or italic still have
+// to be faked because there was no face for them.
+func (faces Faces) For(style Style) (face font.Face, fake_bold bool, fake_italic bool) {
+	if style.Scale > 0 && style.Scale != 1 && faces.At != nil && faces.Size > 0 {
+		scaled := faces.At(faces.Size * style.Scale);
+		style.Scale = 1;
+		return scaled.For(style);
+	}
+
+	switch {
+	case style.Code && faces.Mono != nil:
+		return faces.Mono, false, false;
+	case style.Bold && style.Italic && faces.BoldItalic != nil:
+		return faces.BoldItalic, false, false;
+	case style.Bold && style.Italic && faces.Italic != nil:
+		return faces.Italic, true, false;
+	case style.Bold && style.Italic && faces.Bold != nil:
+		return faces.Bold, false, true;
+	case style.Bold && !style.Italic && faces.Bold != nil:
+		return faces.Bold, false, false;
+	case style.Italic && !style.Bold && faces.Italic != nil:
+		return faces.Italic, false, false;
+	}
+	return faces.Regular, style.Bold && !style.Code, style.Italic && !style.Code;
+}
+
+// Piece is the part of a run that ended up on one line.
+type Piece struct {
+	Text string
+	Style Style
+	Face font.Face
+	X float64 // from the start of the line
+	Width float64
+	FakeBold bool
+	FakeItalic bool
+}
+
+// Line is one wrapped line of runs.
+type Line struct {
+	Pieces []Piece
+	Width float64
+	Last bool // the last line of a paragraph, which justifying leaves alone
+}
+
+// Text returns the line without its styling.
+func (line Line) Text() string {
+	s := "";
+	for _, piece := range line.Pieces {
+		s += piece.Text;
+	}
+	return s;
+}
+
+// WrapRuns is Wrap for styled text. Break opportunities are found on the
+// text as a whole, so words that change style halfway stay together.
+func WrapRuns(runs []Run, width float64, faces Faces) []Line {
+	var text strings.Builder;
+	starts := make([]int, len(runs));
+	for i, run := range runs {
+		starts[i] = text.Len();
+		text.WriteString(run.Text);
+	}
+	s := text.String();
+
+	// faces only get looked up once per run, scaled runs make new ones.
+	type runFace struct {
+		face font.Face
+		fake_bold, fake_italic bool
+	}
+	run_faces := make([]runFace, len(runs));
+	for i, run := range runs {
+		face, fake_bold, fake_italic := faces.For(run.Style);
+		run_faces[i] = runFace{ face, fake_bold, fake_italic };
+	}
+
+	// each calls f with the parts of the byte range [start, end) of s in
+	// each run, finding the first run by binary search so a line only
+	// costs the runs it has.
+	each := func(start, end int, f func(i, a, b int)) {
+		first := sort.Search(len(runs), func(i int) bool {
+			return starts[i] + len(runs[i].Text) > start;
+		});
+		for i := first; i < len(runs) && starts[i] < end; i++ {
+			if a, b := max(start, starts[i]), min(end, starts[i] + len(runs[i].Text)); a < b {
+				f(i, a, b);
+			}
+		}
+	};
+	pieces := func(start, end int) []Piece {
+		var out []Piece;
+		x := 0.0;
+		each(start, end, func(i, a, b int) {
+			rf := run_faces[i];
+			w := FaceMeasurer(rf.face)(s[a:b]);
+			out = append(out, Piece{
+				Text: s[a:b],
+				Style: runs[i].Style,
+				Face: rf.face,
+				X: x,
+				Width: w,
+				FakeBold: rf.fake_bold,
+				FakeItalic: rf.fake_italic,
+			});
+			x += w;
+		});
+		return out;
+	};
+	measure := func(start, end int) float64 {
+		w := 0.0;
+		each(start, end, func(i, a, b int) {
+			w += FaceMeasurer(run_faces[i].face)(s[a:b]);
+		});
+		return w;
+	};
+
+	var lines []Line;
+	for _, line := range wrapSpans(s, width, measure) {
+		p := pieces(line.start, line.end);
+		lines = append(lines, Line{ Pieces: p, Width: linePiecesWidth(p), Last: line.hard });
+	}
+	return lines;
+}
+
+func linePiecesWidth(pieces []Piece) float64 {
+	if len(pieces) == 0 {
+		return 0;
+	}
+	last := pieces[len(pieces)-1];
+	return last.X + last.Width;
+}
+
+// TruncateLines keeps the first n lines. If anything was dropped, the last
+// kept line is shortened until it fits in width with an ellipsis on the end.
+// at least one line is kept, so cut text always shows it was cut.
+func TruncateLines(lines []Line, n int, width float64, faces Faces) []Line {
+	if len(lines) <= n {
+		return lines;
+	}
+	n = max(n, 1);
+	kept := append([]Line{}, lines[:n]...);
+	pieces := append([]Piece{}, kept[n-1].Pieces...);
+
+	for len(pieces) > 0 {
+		last := &pieces[len(pieces)-1];
+		measure := FaceMeasurer(last.Face);
+		with_ellipsis := trimLine(last.Text) + Ellipsis;
+		if w := measure(with_ellipsis); last.X + w <= width {
+			last.Text = with_ellipsis;
+			last.Width = w;
+			kept[n-1] = Line{ Pieces: pieces, Width: linePiecesWidth(pieces) };
+			return kept;
+		}
+
+		// drop one cluster at a time, and the whole piece once it's empty.
+		clusters := Graphemes(trimLine(last.Text));
+		if len(clusters) <= 1 {
+			pieces = pieces[:len(pieces)-1];
+			continue;
+		}
+		last.Text = joinClusters(clusters[:len(clusters)-1]);
+		last.Width = measure(last.Text);
+	}
+
+	ellipsis := Piece{ Text: Ellipsis, Face: faces.Regular };
+	ellipsis.Width = FaceMeasurer(ellipsis.Face)(Ellipsis);
+	kept[n-1] = Line{ Pieces: []Piece{ ellipsis }, Width: ellipsis.Width };
+	return kept;
+}
@@ -0,0 +1,42 @@
+package layout
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// every run's text ends up on a line, in order, and lines with many runs
+// don't cost more to wrap than their own runs.
+func TestWrapRunsManyRuns(t *testing.T) {
+	faces := goFacesAt(t)(20);
+	var runs []Run;
+	var want strings.Builder;
+	for i := 0; i < 20000; i++ {
+		style := Style{ Bold: i % 2 == 0, Italic: i % 3 == 0 };
+		text := "word" + strings.Repeat("s", i % 5) + " ";
+		runs = append(runs, Run{ Text: text, Style: style });
+		want.WriteString(text);
+	}
+
+	start := time.Now();
+	lines := WrapRuns(runs, 400, faces);
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("took %v", took);
+	}
+	var got strings.Builder;
+	for _, line := range lines {
+		x := 0.0;
+		for _, piece := range line.Pieces {
+			if piece.X < x - 0.001 {
+				t.Fatalf("piece %q starts at %g, before the one before it ends at %g", piece.Text, piece.X, x);
+			}
+			x = piece.X + piece.Width;
+			got.WriteString(piece.Text);
+		}
+		got.WriteString(" ");
+	}
+	if strings.Join(strings.Fields(got.String()), " ") != strings.Join(strings.Fields(want.String()), " ") {
+		t.Error("wrapped text isn't the text given");
+	}
+}
@@ -0,0 +1,88 @@
+package layout
+
+import (
+	"strings"
+
+	"golang.org/x/image/font"
+)
+
+// Measurer returns the advance width of a string in pixels.
+type Measurer func(s string) float64
+
+// FaceMeasurer measures strings with a font face, the same way gg does.
+func FaceMeasurer(face font.Face) Measurer {
+	return func(s string) float64 {
+		return float64(font.MeasureString(face, s) >> 6);
+	}
+}
+
+func isTrailingSpace(r rune) bool {
+	c := breakClassOf(r);
+	return c == lbSP || c == lbBK || c == lbCR || c == lbLF || c == lbNL || c == lbZW;
+}
+
+// trailing whitespace never counts towards a line's width.
+func trimLine(s string) string {
+	return strings.TrimRightFunc(s, isTrailingSpace);
+}
+
+// span is a byte range of the text being wrapped. hard is set when the
+// line ends at a mandatory break, the end of a paragraph.
+type span struct {
+	start, end int
+	hard bool
+}
+
+// wrapSpans does the actual line breaking for Wrap and WrapRuns. measure
+// gets byte ranges of s with the trailing whitespace already cut off.
+func wrapSpans(s string, width float64, measure func(start, end int) float64) []span {
+	var lines []span;
+	trimmed := func(start, end int) int {
+		return start + len(trimLine(s[start:end]));
+	};
+	line := span{ 0, 0, false };
+	offset := 0;
+
+	for _, seg := range Segments(s) {
+		seg_start, seg_end := offset, offset + len(seg.Text);
+		offset = seg_end;
+
+		if line.end > line.start && measure(line.start, trimmed(line.start, seg_end)) > width {
+			lines = append(lines, span{ line.start, trimmed(line.start, line.end), false });
+			line = span{ seg_start, seg_start, false };
+		}
+		line.end = seg_end;
+
+		if measure(line.start, trimmed(line.start, line.end)) > width {
+			// the token alone overflows, so chop it up between clusters.
+			// a line always keeps at least one cluster, even if that one
+			// cluster is too wide by itself.
+			at := line.start;
+			for _, cluster := range seg.Clusters {
+				next := at + len(cluster);
+				if at > line.start && measure(line.start, trimmed(line.start, next)) > width {
+					lines = append(lines, span{ line.start, at, false });
+					line.start = at;
+				}
+				at = next;
+			}
+		}
+
+		if seg.Break == MandatoryBreak {
+			lines = append(lines, span{ line.start, trimmed(line.start, line.end), true });
+			line = span{ seg_end, seg_end, false };
+		}
+	}
+	return lines;
+}
+
+// Wrap breaks s into lines no wider than width, at UAX #14 break
+// opportunities. Words that are wider than a line on their own get
+// broken between grapheme clusters.
+func Wrap(s string, width float64, measure Measurer) []string {
+	var lines []string;
+	for _, line := range wrapSpans(s, width, func(start, end int) float64 { return measure(s[start:end]) }) {
+		lines = append(lines, s[line.start:line.end]);
+	}
+	return lines;
+}
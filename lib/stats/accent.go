@@ -0,0 +1,42 @@
+package stats
+
+import (
+	"image/color"
+	"math"
+)
+
+// swatches this grey, or this rare, aren't picked as an accent.
+const min_accent_saturation = 0.2;
+const min_accent_share = 0.01;
+
+// Accent picks the most vibrant of swatches: saturated, not too dark or too
+// light, and common enough to belong to the image. ok is false when every
+// swatch is too grey to be worth using.
+func Accent(swatches []Swatch) (accent color.NRGBA, ok bool) {
+	best := 0.0;
+	for _, s := range swatches {
+		saturation, lightness := saturationLightness(s.Color);
+		if saturation < min_accent_saturation || s.Share < min_accent_share {
+			continue;
+		}
+		// lightness counts most around 0.55 and falls off to nothing at
+		// black. share counts for little, a small bright patch is what
+		// makes an accent.
+		score := saturation * (1 - math.Abs(lightness - 0.55) / 0.55) * math.Pow(s.Share, 0.25);
+		if score > best {
+			best, accent, ok = score, s.Color, true;
+		}
+	}
+	return accent, ok;
+}
+
+// saturationLightness is c's hsl saturation and lightness, 0 to 1.
+func saturationLightness(c color.NRGBA) (float64, float64) {
+	r, g, b := float64(c.R) / 255, float64(c.G) / 255, float64(c.B) / 255;
+	high, low := math.Max(r, math.Max(g, b)), math.Min(r, math.Min(g, b));
+	lightness := (high + low) / 2;
+	if high == low {
+		return 0, lightness;
+	}
+	return (high - low) / (1 - math.Abs(2 * lightness - 1)), lightness;
+}
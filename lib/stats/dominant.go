@@ -0,0 +1,85 @@
+package stats
+
+import (
+	"image"
+	"image/color"
+	"sort"
+)
+
+// Swatch is one of an image's main colours.
+type Swatch struct {
+	Color color.NRGBA
+	Share float64 // of the measured pixels that are close to it, 0 to 1
+}
+
+// colours closer than this, squared, per channel summed, count as one.
+const swatch_distance = 48 * 48;
+
+// DominantColors is up to n of the most common colours in region of img,
+// most common first. colours are binned 16 levels a channel, and bins
+// that come out too close to a more common one are folded into it.
+func DominantColors(img image.Image, region image.Rectangle, n int) []Swatch {
+	type bin struct {
+		key, r, g, b, count int
+	}
+	bins := map[int]*bin{};
+	total := 0;
+	sample(img, region, func(c color.NRGBA) {
+		key := int(c.R >> 4) << 8 | int(c.G >> 4) << 4 | int(c.B >> 4);
+		b, ok := bins[key];
+		if !ok {
+			b = &bin{ key: key };
+			bins[key] = b;
+		}
+		b.r += int(c.R);
+		b.g += int(c.G);
+		b.b += int(c.B);
+		b.count++;
+		total++;
+	});
+	if total == 0 || n <= 0 {
+		return nil;
+	}
+
+	sorted := make([]*bin, 0, len(bins));
+	for _, b := range bins {
+		sorted = append(sorted, b);
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].count != sorted[j].count {
+			return sorted[i].count > sorted[j].count;
+		}
+		// ties go the same way every time.
+		return sorted[i].key < sorted[j].key;
+	});
+
+	var swatches []Swatch;
+	var counts []int;
+	for _, b := range sorted {
+		c := color.NRGBA{ uint8(b.r / b.count), uint8(b.g / b.count), uint8(b.b / b.count), 255 };
+		merged := false;
+		for i := range swatches {
+			if distance(swatches[i].Color, c) < swatch_distance {
+				counts[i] += b.count;
+				merged = true;
+				break;
+			}
+		}
+		if !merged && len(swatches) < n {
+			swatches = append(swatches, Swatch{ Color: c });
+			counts = append(counts, b.count);
+		}
+	}
+	for i := range swatches {
+		swatches[i].Share = float64(counts[i]) / float64(total);
+	}
+	sort.SliceStable(swatches, func(i, j int) bool {
+		return swatches[i].Share > swatches[j].Share;
+	});
+	return swatches;
+}
+
+func distance(a, b color.NRGBA) int {
+	dr, dg, db := int(a.R) - int(b.R), int(a.G) - int(b.G), int(a.B) - int(b.B);
+	return dr * dr + dg * dg + db * db;
+}
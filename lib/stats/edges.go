@@ -0,0 +1,69 @@
+package stats
+
+import (
+	"image"
+	"math"
+)
+
+// Sobel is the edge strength at x, y of a grid of values read with at. a
+// hard step of 1 from one side to the other gives 4.
+func Sobel(at func(x, y int) float64, x, y int) float64 {
+	gx := at(x+1, y-1) + 2 * at(x+1, y) + at(x+1, y+1) - at(x-1, y-1) - 2 * at(x-1, y) - at(x-1, y+1);
+	gy := at(x-1, y+1) + 2 * at(x, y+1) + at(x+1, y+1) - at(x-1, y-1) - 2 * at(x, y-1) - at(x+1, y-1);
+	return math.Hypot(gx, gy);
+}
+
+// EdgeMap is the sobel edge strength of every value of rows, which all
+// have to be the same length. past the sides the values nearest them are
+// used.
+func EdgeMap(rows [][]float64) [][]float64 {
+	h := len(rows);
+	if h == 0 {
+		return nil;
+	}
+	w := len(rows[0]);
+	at := func(x, y int) float64 {
+		return rows[min(h - 1, max(0, y))][min(w - 1, max(0, x))];
+	};
+	edges := make([][]float64, h);
+	for y := range edges {
+		edges[y] = make([]float64, w);
+		for x := range edges[y] {
+			edges[y][x] = Sobel(at, x, y);
+		}
+	}
+	return edges;
+}
+
+// a point is on an edge when its sobel strength is at least this share of
+// a black to white step.
+const edge_threshold = 0.1;
+
+// EdgeDensity is the share of region of img that's on an edge, 0 for flat
+// colour up to 1 for fine detail everywhere. regions too small to have a
+// point with neighbours all round are 0.
+func EdgeDensity(img image.Image, region image.Rectangle) float64 {
+	return edgeDensity(sample(img, region, nil));
+}
+
+func edgeDensity(g grid) float64 {
+	at := func(x, y int) float64 {
+		return g.lum[y * g.w + x];
+	};
+	edges, n := 0, 0;
+	for y := 1; y < g.h - 1; y++ {
+		for x := 1; x < g.w - 1; x++ {
+			if !g.whole(x, y) {
+				continue;
+			}
+			if Sobel(at, x, y) / 4 >= edge_threshold {
+				edges++;
+			}
+			n++;
+		}
+	}
+	if n == 0 {
+		return 0;
+	}
+	return float64(edges) / float64(n);
+}
@@ -0,0 +1,127 @@
+package stats
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// big regions are read on a grid of at most this many points each way.
+const max_samples = 128;
+
+// grid is a region of an image read every step pixels, as luminance.
+// pixels that are fully transparent, or outside the image, aren't set.
+type grid struct {
+	w, h int
+	lum []float64
+	set []bool
+}
+
+// whole is whether x, y and the points all round it are set.
+func (g grid) whole(x, y int) bool {
+	for dy := -1; dy <= 1; dy++ {
+		for dx := -1; dx <= 1; dx++ {
+			if !g.set[(y + dy) * g.w + x + dx] {
+				return false;
+			}
+		}
+	}
+	return true;
+}
+
+// sample reads region of img. it works for any size of region, down to a
+// single pixel, and for gif frames that only cover part of the canvas.
+func sample(img image.Image, region image.Rectangle, visit func(c color.NRGBA)) grid {
+	step_x := max(1, (region.Dx() + max_samples - 1) / max_samples);
+	step_y := max(1, (region.Dy() + max_samples - 1) / max_samples);
+	g := grid{ w: max(0, (region.Dx() + step_x - 1) / step_x), h: max(0, (region.Dy() + step_y - 1) / step_y) };
+	g.lum = make([]float64, g.w * g.h);
+	g.set = make([]bool, g.w * g.h);
+
+	inside := img.Bounds();
+	for gy := 0; gy < g.h; gy++ {
+		for gx := 0; gx < g.w; gx++ {
+			p := image.Pt(region.Min.X + gx * step_x, region.Min.Y + gy * step_y);
+			if !p.In(inside) {
+				continue;
+			}
+			c := color.NRGBAModel.Convert(img.At(p.X, p.Y)).(color.NRGBA);
+			if c.A == 0 {
+				continue;
+			}
+			i := gy * g.w + gx;
+			g.lum[i], g.set[i] = luminanceOf(c), true;
+			if visit != nil {
+				visit(c);
+			}
+		}
+	}
+	return g;
+}
+
+// Histogram counts relative luminance in 256 bins from black to white.
+type Histogram struct {
+	Bins [256]int
+	Count int
+	sum float64
+}
+
+func (h *Histogram) Add(l float64) {
+	h.Bins[int(math.Max(0, math.Min(1, l)) * 255 + 0.5)]++;
+	h.Count++;
+	h.sum += l;
+}
+
+// Merge adds everything counted in other, to measure several gif frames
+// as one.
+func (h *Histogram) Merge(other Histogram) {
+	for i, n := range other.Bins {
+		h.Bins[i] += n;
+	}
+	h.Count += other.Count;
+	h.sum += other.sum;
+}
+
+// Mean is the average luminance, 0 when nothing was counted.
+func (h Histogram) Mean() float64 {
+	if h.Count == 0 {
+		return 0;
+	}
+	return h.sum / float64(h.Count);
+}
+
+// Percentile is the luminance p of the way up, p from 0 to 1.
+func (h Histogram) Percentile(p float64) float64 {
+	if h.Count == 0 {
+		return 0;
+	}
+	target := int(p * float64(h.Count));
+	seen := 0;
+	for i, n := range h.Bins {
+		seen += n;
+		if seen > target {
+			return float64(i) / 255;
+		}
+	}
+	return 1;
+}
+
+// Median is the luminance half of the way up.
+func (h Histogram) Median() float64 {
+	return h.Percentile(0.5);
+}
+
+// LuminanceHistogram is the histogram of region of img.
+func LuminanceHistogram(img image.Image, region image.Rectangle) Histogram {
+	return histogramOf(sample(img, region, nil));
+}
+
+func histogramOf(g grid) Histogram {
+	var h Histogram;
+	for i, ok := range g.set {
+		if ok {
+			h.Add(g.lum[i]);
+		}
+	}
+	return h;
+}
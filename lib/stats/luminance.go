@@ -0,0 +1,39 @@
+package stats
+
+import (
+	"image/color"
+	"math"
+)
+
+// linear undoes the sRGB curve on a 0 to 1 channel, the WCAG way.
+func linear(v float64) float64 {
+	if v <= 0.03928 {
+		return v / 12.92;
+	}
+	return math.Pow((v + 0.055) / 1.055, 2.4);
+}
+
+// the curve for every 8 bit channel value, worked out once.
+var linear_table = func() (table [256]float64) {
+	for i := range table {
+		table[i] = linear(float64(i) / 255);
+	}
+	return;
+}();
+
+// Luminance is c's WCAG relative luminance, from 0 for black to 1 for
+// white. alpha is ignored.
+func Luminance(c color.Color) float64 {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA);
+	return luminanceOf(n);
+}
+
+func luminanceOf(n color.NRGBA) float64 {
+	return 0.2126 * linear_table[n.R] + 0.7152 * linear_table[n.G] + 0.0722 * linear_table[n.B];
+}
+
+// ContrastRatio is the WCAG contrast ratio between two relative
+// luminances, from 1 to 21.
+func ContrastRatio(a, b float64) float64 {
+	return (math.Max(a, b) + 0.05) / (math.Min(a, b) + 0.05);
+}
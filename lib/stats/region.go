@@ -0,0 +1,65 @@
+package stats
+
+import (
+	"image"
+	"image/gif"
+)
+
+// Region is what a part of an image looks like, for deciding how to draw
+// over it.
+type Region struct {
+	Histogram Histogram
+	Mean float64 // average relative luminance
+	Median float64
+	Low float64 // 5th percentile of luminance, so a few stray pixels don't count
+	High float64 // and the 95th
+	EdgeDensity float64 // share of the region on an edge, 0 to 1
+}
+
+// Measure reads region of img, which can be any image, gif frames too.
+// parts of region outside img, or transparent, are left out.
+func Measure(img image.Image, region image.Rectangle) Region {
+	g := sample(img, region, nil);
+	return regionOf(histogramOf(g), edgeDensity(g));
+}
+
+// MeasureFrames is Measure over several frames at once, as if they were
+// one picture.
+func MeasureFrames(frames []image.Image, region image.Rectangle) Region {
+	var h Histogram;
+	edges, measured := 0.0, 0;
+	for _, frame := range frames {
+		g := sample(frame, region, nil);
+		frame_histogram := histogramOf(g);
+		if frame_histogram.Count == 0 {
+			continue;
+		}
+		h.Merge(frame_histogram);
+		edges += edgeDensity(g);
+		measured++;
+	}
+	if measured > 0 {
+		edges /= float64(measured);
+	}
+	return regionOf(h, edges);
+}
+
+// MeasureGif is MeasureFrames over every frame of src, each on its own.
+func MeasureGif(src *gif.GIF, region image.Rectangle) Region {
+	frames := make([]image.Image, len(src.Image));
+	for i, frame := range src.Image {
+		frames[i] = frame;
+	}
+	return MeasureFrames(frames, region);
+}
+
+func regionOf(h Histogram, edges float64) Region {
+	return Region{
+		Histogram: h,
+		Mean: h.Mean(),
+		Median: h.Median(),
+		Low: h.Percentile(0.05),
+		High: h.Percentile(0.95),
+		EdgeDensity: edges,
+	};
+}
@@ -0,0 +1,151 @@
+package stats
+
+import (
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"math"
+	"testing"
+)
+
+// solid is a w x h image of c.
+func solid(w, h int, c color.Color) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h));
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, c);
+		}
+	}
+	return img;
+}
+
+// stripes is a w x h image of black and white stripes two pixels wide, so
+// every point with neighbours all round is on an edge.
+func stripes(w, h int) *image.RGBA {
+	img := solid(w, h, color.Black);
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if x % 4 >= 2 {
+				img.Set(x, y, color.White);
+			}
+		}
+	}
+	return img;
+}
+
+// a single pixel is measured as itself, and has no edges.
+func TestMeasureOnePixel(t *testing.T) {
+	grey := color.RGBA{ 128, 128, 128, 255 };
+	want := Luminance(grey);
+	r := Measure(solid(1, 1, grey), image.Rect(0, 0, 1, 1));
+	if r.Histogram.Count != 1 {
+		t.Fatalf("counted %d pixels, want 1", r.Histogram.Count);
+	}
+	for name, got := range map[string]float64{ "mean": r.Mean, "median": r.Median, "low": r.Low, "high": r.High } {
+		if math.Abs(got - want) > 1.0 / 255 {
+			t.Errorf("%s is %g, want %g", name, got, want);
+		}
+	}
+	if r.EdgeDensity != 0 {
+		t.Errorf("edge density is %g, want 0", r.EdgeDensity);
+	}
+}
+
+// images smaller than a sobel kernel's reach all round, and the smallest
+// ones that have one, measure without going out of bounds.
+func TestMeasureTinyImages(t *testing.T) {
+	for w := 1; w < 8; w++ {
+		for h := 1; h < 8; h++ {
+			img := stripes(w, h);
+			r := Measure(img, img.Rect);
+			if r.Histogram.Count != w * h {
+				t.Errorf("%dx%d: counted %d pixels", w, h, r.Histogram.Count);
+			}
+			if r.Low != 0 || (w >= 3 && r.High != 1) {
+				t.Errorf("%dx%d: measured from %g to %g", w, h, r.Low, r.High);
+			}
+			switch {
+			case (w < 3 || h < 3) && r.EdgeDensity != 0:
+				t.Errorf("%dx%d: edge density %g, want 0 with no point inside", w, h, r.EdgeDensity);
+			case w >= 3 && h >= 3 && r.EdgeDensity != 1:
+				t.Errorf("%dx%d: edge density %g, want 1 for stripes", w, h, r.EdgeDensity);
+			}
+		}
+	}
+}
+
+// parts of the region outside the image, or transparent, don't count.
+func TestMeasureLeavesOutMissingPixels(t *testing.T) {
+	img := solid(4, 4, color.White);
+	img.Set(0, 0, color.Transparent);
+	if n := LuminanceHistogram(img, image.Rect(-2, -2, 6, 6)).Count; n != 15 {
+		t.Errorf("counted %d pixels, want 15", n);
+	}
+	if r := Measure(img, image.Rect(10, 10, 20, 20)); r.Histogram.Count != 0 || r.Mean != 0 || r.EdgeDensity != 0 {
+		t.Errorf("a region off the image measured %+v", r);
+	}
+	if r := Measure(img, image.Rectangle{}); r.Histogram.Count != 0 {
+		t.Errorf("an empty region counted %d pixels", r.Histogram.Count);
+	}
+}
+
+func TestHistogramMedian(t *testing.T) {
+	var h Histogram;
+	for _, l := range []float64{ 0, 0.2, 0.4, 0.6, 1 } {
+		h.Add(l);
+	}
+	if got := h.Median(); math.Abs(got - 0.4) > 1.0 / 255 {
+		t.Errorf("median is %g, want 0.4", got);
+	}
+	if got := (Histogram{}).Median(); got != 0 {
+		t.Errorf("median of nothing is %g, want 0", got);
+	}
+}
+
+// flat colour has no edges, a hard step has some, fine detail is all edge.
+func TestEdgeDensity(t *testing.T) {
+	step := solid(20, 20, color.Black);
+	for y := 0; y < 20; y++ {
+		for x := 10; x < 20; x++ {
+			step.Set(x, y, color.White);
+		}
+	}
+	flat, half, busy := EdgeDensity(solid(20, 20, color.White), step.Rect), EdgeDensity(step, step.Rect), EdgeDensity(stripes(20, 20), step.Rect);
+	if flat != 0 || half <= 0 || half >= 0.5 || busy != 1 {
+		t.Errorf("flat %g, step %g, stripes %g, want 0, a little, 1", flat, half, busy);
+	}
+}
+
+func TestEdgeMap(t *testing.T) {
+	if EdgeMap(nil) != nil {
+		t.Error("no rows should make no map");
+	}
+	if got := EdgeMap([][]float64{ { 7 } }); len(got) != 1 || len(got[0]) != 1 || got[0][0] != 0 {
+		t.Errorf("a single value should be flat, got %v", got);
+	}
+	got := EdgeMap([][]float64{ { 0, 0, 1, 1 }, { 0, 0, 1, 1 } });
+	if got[0][0] != 0 || got[0][1] != 4 || got[0][2] != 4 || got[0][3] != 0 {
+		t.Errorf("a step of 1 should be 4 either side of it, got %v", got);
+	}
+}
+
+// every frame of a gif is measured, frames covering only part of the
+// canvas too.
+func TestMeasureGif(t *testing.T) {
+	frame := func(rect image.Rectangle, c color.Color) *image.Paletted {
+		img := image.NewPaletted(rect, palette.Plan9);
+		for i := range img.Pix {
+			img.Pix[i] = uint8(img.Palette.Index(c));
+		}
+		return img;
+	};
+	src := &gif.GIF{
+		Image: []*image.Paletted{ frame(image.Rect(0, 0, 1, 1), color.Black), frame(image.Rect(3, 3, 5, 5), color.White) },
+		Config: image.Config{ Width: 6, Height: 6 },
+	};
+	r := MeasureGif(src, image.Rect(0, 0, 6, 6));
+	if r.Histogram.Count != 5 || r.Low != 0 || r.High != 1 {
+		t.Errorf("measured %d pixels from %g to %g, want 5 from 0 to 1", r.Histogram.Count, r.Low, r.High);
+	}
+}
@@ -0,0 +1,141 @@
+package styles
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"strings"
+
+	"github.com/disintegration/gift"
+	"github.com/fogleman/gg"
+)
+
+// Attachment is an image that came with the quoted message, shown with the
+// text.
+type Attachment struct {
+	Image image.Image
+	Position string // one of AttachmentPositions, empty is below
+}
+
+// AttachmentPositions are where an attachment can go: under the quote, or
+// next to it on the side away from the avatar.
+var AttachmentPositions = []string{ "below", "beside" };
+
+func (a Attachment) Validate() error {
+	switch a.Position {
+	case "", "below", "beside":
+		return nil;
+	}
+	return fmt.Errorf("unknown attachment position %q, have: %s", a.Position, strings.Join(AttachmentPositions, ", "));
+}
+
+// sizes at 720p, and how much room an attachment gets.
+const (
+	attachment_gap = 24
+	attachment_radius = 16
+	attachment_below_share = 0.45 // of the text area's height, below the text
+	attachment_beside_share = 0.4 // of the column's width, beside the text
+	attachment_max_zoom = 2 // small images aren't blown up more than this
+)
+
+// attachmentBox is an attachment fitted next to a column of text, already
+// scaled and with its corners rounded, so gif frames can share it.
+type attachmentBox struct {
+	img *image.RGBA
+	width, height float64
+	beside bool
+	gap float64
+}
+
+// newAttachmentBox fits a into a column_width wide column with area_height
+// of room, keeping its shape. nil when there's no attachment.
+func newAttachmentBox(a *Attachment, column_width, area_height, scale float64) *attachmentBox {
+	if a == nil || a.Image == nil {
+		return nil;
+	}
+	max_w, max_h := column_width, area_height * attachment_below_share;
+	if a.Position == "beside" {
+		max_w, max_h = column_width * attachment_beside_share, area_height;
+	}
+	return fitAttachment(a, max_w, max_h, scale);
+}
+
+// fitAttachment scales a to fit max_w x max_h, keeping its shape.
+func fitAttachment(a *Attachment, max_w, max_h, scale float64) *attachmentBox {
+	box := &attachmentBox{ beside: a.Position == "beside", gap: attachment_gap * scale };
+	b := a.Image.Bounds();
+	f := math.Min(attachment_max_zoom, math.Min(max_w / float64(b.Dx()), max_h / float64(b.Dy())));
+	w, h := max(1, int(math.Round(float64(b.Dx()) * f))), max(1, int(math.Round(float64(b.Dy()) * f)));
+	box.width, box.height = float64(w), float64(h);
+
+	scaled := image.NewRGBA(image.Rect(0, 0, w, h));
+	gift.New(gift.Resize(w, h, gift.LanczosResampling)).Draw(scaled, a.Image);
+	corners := gg.NewContext(w, h);
+	corners.DrawRoundedRectangle(0, 0, float64(w), float64(h), math.Min(attachment_radius * scale, math.Min(float64(w), float64(h)) / 2));
+	corners.Fill();
+	box.img = image.NewRGBA(scaled.Rect);
+	draw.DrawMask(box.img, box.img.Rect, scaled, image.Point{}, corners.Image(), image.Point{}, draw.Over);
+	return box;
+}
+
+// textWidth is how much of a column_width column is left for the text.
+func (box *attachmentBox) textWidth(column_width float64) float64 {
+	if box == nil || !box.beside {
+		return column_width;
+	}
+	return column_width - box.width - box.gap;
+}
+
+// below is the height it takes up under the text.
+func (box *attachmentBox) below() float64 {
+	if box == nil || box.beside {
+		return 0;
+	}
+	return box.gap + box.height;
+}
+
+// besideHeight is the height of a row of text_height text with the
+// attachment next to it.
+func (box *attachmentBox) besideHeight(text_height float64) float64 {
+	if box == nil || !box.beside {
+		return text_height;
+	}
+	return math.Max(text_height, box.height);
+}
+
+// place lays out a quote of quote_height with box in a column at
+// left, width wide, starting at top. the attachment goes on the right when
+// right is set and it's beside the text, and is lined up by align when it's
+// below. it returns where the quote goes and where the text under it starts.
+func (box *attachmentBox) place(left, width, top, quote_height float64, align Align, right bool) (quote_left, quote_top, under float64, at image.Point) {
+	if box == nil {
+		return left, top, top + quote_height, image.Point{};
+	}
+	if box.beside {
+		row := box.besideHeight(quote_height);
+		quote_left, quote_top = left, top + (row - quote_height) / 2;
+		x := left + width - box.width;
+		if !right {
+			x, quote_left = left, left + box.width + box.gap;
+		}
+		return quote_left, quote_top, top + row, image.Pt(int(math.Round(x)), int(math.Round(top + (row - box.height) / 2)));
+	}
+	x := left;
+	switch align {
+	case AlignCenter:
+		x += (width - box.width) / 2;
+	case AlignRight:
+		x += width - box.width;
+	}
+	y := top + quote_height + box.gap;
+	return left, top, y + box.height, image.Pt(int(math.Round(x)), int(math.Round(y)));
+}
+
+// draw puts the attachment on dc with its top left at at.
+func (box *attachmentBox) draw(dc *gg.Context, at image.Point) {
+	if box == nil {
+		return;
+	}
+	draw.Draw(dc.Image().(*image.RGBA), box.img.Rect.Add(at), box.img, image.Point{}, draw.Over);
+}
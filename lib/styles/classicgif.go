@@ -4,26 +4,43 @@ import (
 	"image"
 	"image/gif"
 
-	"golang.org/x/image/font"
-	"github.com/disintegration/gift"
+	"canvas/lib/layout"
 	"canvas/lib/utils"
 )
 
-// text string, author string, src *image.Image, gradient *image.Image, font *font.Face, small_font *font.Face
-func ModifyClassicGif(src *gif.GIF, font *font.Face, small_font *font.Face, text string, author string, gradient *image.Image) *gif.GIF {
+// ModifyClassicGif is ModifyClassicImage for every frame of src, on a size canvas.
+func ModifyClassicGif(src *gif.GIF, size image.Point, faces layout.Faces, author_faces layout.Faces, quote []layout.Run, author []layout.Run, details []layout.Run, gradient utils.Gradient, fit *FitOptions, theme Theme, placement Placement, options RenderOptions) *gif.GIF {
 	newGif := &gif.GIF{};
 
-	width := int(float32(src.Config.Height) * 1.77778);
-	grad := image.NewRGBA(image.Rect(0, 0, width, src.Config.Height));
-	resizer := gift.New(gift.Resize(0, src.Config.Height, gift.LinearResampling))
-	resizer.Draw(grad, *gradient);
+	frame := newClassicFrame(size, placement, options.Attachment);
+	grad := frame.gradient(gradient);
+	src_canvas := image.Rect(0, 0, src.Config.Width, src.Config.Height);
+	// the crop is picked once, from the first frame, so it doesn't jump around.
+	focus_x, focus_y := coverFocus(options.Crop, src.Image[0], src_canvas, frame.avatar);
 
-    quantizer := utils.NewOctreeQuantizer()
-	utils.AddColorsToQuantizer(quantizer, src);
-    colorCount := 256; // colors. 256 before.
-	palette := quantizer.MakePalette(colorCount)
-	colorPalette := utils.ConvertToColorPalette(palette);
-	screenResolution := image.Rect(0, 0, width, src.Config.Height);
+    quantizer := gifQuantizer(src, options.Filters);
+	if frame.attachment != nil {
+		utils.AddImageColorsToQuantizer(quantizer, frame.attachment.img);
+	}
+	addWatermarkColors(quantizer, options.Watermark, size);
+	screenResolution := frame.resolution;
+	quote_block, author_block, details_block := classicBlocks(quote, author, details, faces, author_faces, frame, 9, fit);
+	placed := frame.place(quote_block, author_block, details_block);
+
+	// the text's ink is picked once, from what's under it across the whole
+	// gif, so it doesn't flicker and reads on every frame.
+	background := func(canvas image.Image) image.Image {
+		avatar_img := image.NewRGBA(screenResolution);
+		drawCover(avatar_img, frame.avatar, canvas, src_canvas, focus_x, focus_y);
+		filterRegion(avatar_img, frame.avatar, options.Filters);
+		return classicBackground(avatar_img, grad, frame, placed).Image();
+	};
+	under := measureGif(src, placed.bounds(), background);
+	ink := classicInk(under, frame, placed, theme, options.Contrast, options.Effects);
+
+	addStyleColors(quantizer, theme, ink, background(firstFrame(src)), gradient.From, gradient.To);
+	palette := newGifPalette(quantizer, ink.color, pick(theme.Author, ink.color));
+	colorPalette := palette.colors;
 
 	// the reused image.
 	reusedImage := image.NewPaletted(screenResolution, colorPalette);
@@ -35,7 +52,10 @@ func ModifyClassicGif(src *gif.GIF, font *font.Face, small_font *font.Face, text
 
 		regularImage := image.NewPaletted(screenResolution, colorPalette);
 
-		dc := composeClassicImage(img, grad, *font, *small_font, screenResolution, text, author, 400, 9);
+		avatar_img := image.NewRGBA(screenResolution);
+		drawCover(avatar_img, frame.avatar, img, src_canvas, focus_x, focus_y);
+		filterRegion(avatar_img, frame.avatar, options.Filters);
+		dc := composeClassicImage(avatar_img, grad, frame, quote_block, author_block, details_block, theme, options.Contrast, options.Effects, options.Watermark, &ink);
 		dcImg := dc.Image().(*image.RGBA);
 		bounds := dcImg.Bounds();
 
@@ -52,7 +72,7 @@ func ModifyClassicGif(src *gif.GIF, font *font.Face, small_font *font.Face, text
 				}
 
 				color := utils.NewColor(int(r), int(g), int(b), int(a));
-				index := quantizer.GetPaletteIndex(color);
+				index := palette.index(color);
 				if disposal == gif.DisposalNone {
 					i := reusedImage.PixOffset(x, y);
 					reusedImage.Pix[i] = uint8(index);
@@ -71,11 +91,12 @@ func ModifyClassicGif(src *gif.GIF, font *font.Face, small_font *font.Face, text
 		}
 		newGif.Delay = append(newGif.Delay, delay);
 		newGif.Disposal = append(newGif.Disposal, 1);
+		options.Progress.report(i + 1, len(src.Image));
 	}
 
 	newGif.LoopCount = src.LoopCount;
-	newGif.Config.Height = src.Config.Height;
-	newGif.Config.Width = width;
+	newGif.Config.Height = size.Y;
+	newGif.Config.Width = size.X;
 	newGif.Config.ColorModel = src.Config.ColorModel;
 	newGif.BackgroundIndex = src.BackgroundIndex;
 
@@ -2,66 +2,237 @@ package styles
 
 import (
 	"image"
-	"image/color"
-	"strings"
+	"math"
 
-	"github.com/disintegration/gift"
 	"github.com/fogleman/gg"
-	"golang.org/x/image/font"
+
+	"canvas/lib/layout"
+	"canvas/lib/stats"
+	"canvas/lib/utils"
 )
 
-// for use in images.
-func ModifyClassicImage(text string, author string, src image.Image, gradient image.Image, font *font.Face, small_font *font.Face) *gg.Context {
-	screenResolution := image.Rect(0, 0, 1280, 720);
-	resized := image.NewRGBA(screenResolution);
-	g := gift.New(
-		gift.Resize(720, 0, gift.LanczosResampling), // fastest upscaling.
-		gift.Brightness(-20),
-	);
-	g.Draw(resized, src);
-
-	return composeClassicImage(resized, gradient, *font, *small_font, screenResolution, text, author, 600, 9);
+// FitOptions turns on auto-fit for the quote text. Faces makes the quote
+// fonts at any size, and the picked size stays between MinSize and MaxSize.
+type FitOptions struct {
+	Faces layout.FacesAt
+	MinSize float64
+	MaxSize float64
 }
 
-// img should be below 720x720 to reap LanczosResampling's speed in upscaling.
-// gradient should be exactly 1280x720.
-func composeClassicImage(
-	img image.Image,
-	gradient image.Image,
-	font font.Face,
-	small_font font.Face,
-	resolution image.Rectangle,
-	text string,
-	author string,
-	wrap_width float64,
+// space kept free above and below the quote text, at 720p.
+const classic_margin = 60;
+
+// classicFrame is where things go on a classic canvas. by default
+// landscape and square canvases have the avatar on the left and the text on
+// the right, like the original 1280x720 one, and portrait canvases stack the
+// text under the avatar. everything is in proportion to the canvas.
+type classicFrame struct {
+	resolution image.Rectangle
+	avatar image.Rectangle // the avatar is scaled to cover this
+	side string // where the avatar is, one of AvatarPositions
+	scale float64
+	wrap_width float64
+	text_left float64 // left edge of the text column
+	text_top float64 // the text is placed between text_top and text_bottom
+	text_bottom float64
+	placement Placement
+	attachment *attachmentBox // shares the text column, nil without one
+}
+
+func newClassicFrame(size image.Point, placement Placement, attachment *Attachment) classicFrame {
+	w, h := float64(size.X), float64(size.Y);
+	frame := classicFrame{
+		resolution: image.Rectangle{ Max: size },
+		side: placement.Avatar,
+		scale: Scale(size.X, size.Y),
+		placement: placement,
+	};
+	if frame.side == "" {
+		frame.side = "left";
+		if size.Y > size.X {
+			frame.side = "top";
+		}
+	}
+
+	// at 1280x720: a 720 wide avatar, and 600 wide text 40 from the edge.
+	avatar_width := int(math.Round(w * 720 / base_long));
+	edge := w * 40 / base_long;
+	switch frame.side {
+	case "left":
+		frame.avatar = image.Rect(0, 0, avatar_width, size.Y);
+		frame.wrap_width = w * 600 / base_long;
+		frame.text_left = w - edge - frame.wrap_width;
+		frame.text_top, frame.text_bottom = 0, h;
+	case "right":
+		frame.avatar = image.Rect(size.X - avatar_width, 0, size.X, size.Y);
+		frame.wrap_width = w * 600 / base_long;
+		frame.text_left = edge;
+		frame.text_top, frame.text_bottom = 0, h;
+	case "top":
+		// the same thing on its side: the text's band starts halfway down.
+		margin := classic_margin * frame.scale;
+		frame.avatar = image.Rect(0, 0, size.X, int(math.Round(h * 720 / base_long)));
+		frame.wrap_width = w - 2 * margin;
+		frame.text_left = margin;
+		frame.text_top, frame.text_bottom = h * 640 / base_long, h - h * 40 / base_long;
+	}
+	area := frame.text_bottom - frame.text_top - 2 * classic_margin * frame.scale;
+	frame.attachment = newAttachmentBox(attachment, frame.wrap_width, area, frame.scale);
+	return frame;
+}
+
+// gradient turns the fade with the layout, so it always runs from the
+// avatar towards the text.
+func (frame classicFrame) gradient(gradient utils.Gradient) *image.RGBA {
+	switch frame.side {
+	case "right":
+		gradient.Angle += 180;
+	case "top":
+		gradient.Angle += 90;
+	}
+	return gradient.Render(frame.resolution.Dx(), frame.resolution.Dy());
+}
+
+// ModifyClassicImage draws a size canvas with the avatar, the gradient and
+// the text. details is the small print under the author line, and can be
+// empty. faces should already be scaled for the canvas, see Scale.
+func ModifyClassicImage(quote []layout.Run, author []layout.Run, details []layout.Run, src image.Image, size image.Point, gradient utils.Gradient, faces layout.Faces, author_faces layout.Faces, fit *FitOptions, theme Theme, placement Placement, options RenderOptions) *gg.Context {
+	frame := newClassicFrame(size, placement, options.Attachment);
+	avatar := image.NewRGBA(frame.resolution);
+	focus_x, focus_y := coverFocus(options.Crop, src, src.Bounds(), frame.avatar);
+	drawCover(avatar, frame.avatar, src, src.Bounds(), focus_x, focus_y);
+	filterRegion(avatar, frame.avatar, options.Filters);
+
+	quote_block, author_block, details_block := classicBlocks(quote, author, details, faces, author_faces, frame, 9, fit);
+	dc := composeClassicImage(avatar, frame.gradient(gradient), frame, quote_block, author_block, details_block, theme, options.Contrast, options.Effects, options.Watermark, nil);
+	return dc;
+}
+
+// classicBlocks lays out the quote, the author line and the details. without
+// fit, faces are used as they are and the quote is cut after line_limit
+// lines, or as many as there's room for above the author line. with fit,
+// the quote gets the biggest size that fits there.
+func classicBlocks(
+	quote []layout.Run,
+	author []layout.Run,
+	details []layout.Run,
+	faces layout.Faces,
+	author_faces layout.Faces,
+	frame classicFrame,
 	line_limit int,
-) *gg.Context { // 720p
-	text_x := float64(resolution.Max.X) - 40;
-	text_y := float64(resolution.Max.Y / 2) - 20; // accounting the author text (20)
-	
-	dc := gg.NewContext(resolution.Max.X, resolution.Max.Y);
-	dc.DrawImage(img, 0, 0);
-	dc.DrawImage(gradient, 0, 0);
+	fit *FitOptions,
+) (layout.Block, layout.Block, layout.Block) {
+	wrap_width := frame.attachment.textWidth(frame.wrap_width);
+	author_block := layout.NewBlock(layout.WrapRuns(author, wrap_width / 2, author_faces), author_faces, 1);
+	details_block := layout.NewBlock(layout.WrapRuns(details, wrap_width, author_faces), author_faces, 1);
+
+	// what's left of the text band for the quote.
+	box_height := frame.text_bottom - frame.text_top - 2 * classic_margin * frame.scale - frame.attachment.below() - authorGap(author_block) - author_block.Height - authorGap(details_block) - details_block.Height;
+	if fit == nil {
+		lines := layout.WrapRuns(quote, wrap_width, faces);
+		lines = layout.TruncateLines(lines, min(line_limit, layout.FitLines(lines, faces, box_height, 1)), wrap_width, faces);
+		return layout.NewBlock(lines, faces, 1), author_block, details_block;
+	}
+
+	fitted := layout.Fit(quote, wrap_width, box_height, fit.Faces, fit.MinSize, fit.MaxSize, 1);
+	return layout.NewBlock(fitted.Lines, fitted.Faces, 1), author_block, details_block;
+}
 
-	dc.SetFontFace(font);
-	s := dc.WordWrap(text, wrap_width);
-	if len(s) > line_limit {
-		s = s[:line_limit];
+// the author sits half a line below the quote, and the details half a
+// line below the author.
+func authorGap(author layout.Block) float64 {
+	if len(author.Lines) == 0 {
+		return 0;
 	}
-	stext := strings.Join(s, "\n");
+	return author.Lines[0].Height / 2;
+}
+
+// classicPlaced is where the quote, author, details and attachment go.
+type classicPlaced struct {
+	quote, author, details placedBlock
+	attachment image.Point
+}
 
-	var total_text_height float64 = 0;
-	for _, line := range s {
-		_, line_height := dc.MeasureString(line)
-		total_text_height += line_height - 23;
+// place puts the quote, attachment, author and details together, as one
+// column.
+func (frame classicFrame) place(quote, author, details layout.Block) classicPlaced {
+	box := frame.attachment;
+	wrap_width := box.textWidth(frame.wrap_width);
+	align := frame.placement.align(AlignCenter);
+	gap, details_gap := authorGap(author), authorGap(details);
+	height := box.besideHeight(quote.Height) + box.below() + gap + author.Height + details_gap + details.Height;
+	text_y := frame.placement.anchorY(frame.text_top, frame.text_bottom, classic_margin * frame.scale, height);
+
+	// attachments beside the quote go on the side away from the avatar.
+	text_left, quote_y, under, attachment_at := box.place(frame.text_left, frame.wrap_width, text_y, quote.Height, align, frame.side != "right");
+
+	// the author signs in the column's right half, or the left half when the
+	// quote hugs the left edge.
+	author_x, author_align := text_left + wrap_width / 2, align;
+	switch align {
+	case AlignLeft, AlignJustify:
+		author_x, author_align = text_left, AlignLeft;
 	}
-	dc.SetColor(color.White);
-	dc.DrawStringWrapped(stext, text_x, text_y, 1, 0.5, wrap_width, 1, gg.AlignCenter);
+	placed := classicPlaced{ attachment: attachment_at };
+	placed.quote = placedBlock{ quote, text_left, quote_y, wrap_width, align };
+	placed.author = placedBlock{ author, author_x, under + gap, wrap_width / 2, author_align };
+	placed.details = placedBlock{ details, text_left, placed.author.y + author.Height + details_gap, wrap_width, align };
+	return placed;
+}
 
-	dc.SetColor(color.White);
-	dc.SetFontFace(small_font);
-	dc.DrawStringWrapped(author, text_x, text_y + total_text_height, 1, 0, wrap_width / 2, 1, gg.AlignCenter);
+func (placed classicPlaced) bounds() image.Rectangle {
+	return textBounds(placed.quote, placed.author, placed.details);
+}
 
+// classicBackground is everything under the text: img as it is at the top
+// left, the gradient, which should be the size of the frame, and the
+// attachment.
+func classicBackground(img image.Image, gradient image.Image, frame classicFrame, placed classicPlaced) *gg.Context {
+	dc := gg.NewContext(frame.resolution.Dx(), frame.resolution.Dy());
+	dc.DrawImage(img, 0, 0);
+	dc.DrawImage(gradient, 0, 0);
+	frame.attachment.draw(dc, placed.attachment);
 	return dc;
 }
 
+// classicInk picks the text's ink for a background measured as under.
+func classicInk(under stats.Region, frame classicFrame, placed classicPlaced, theme Theme, contrast Contrast, effects Effects) textInk {
+	ink := pickInk(under, theme.Text, contrast);
+	ink.effects = effectLayer(frame.resolution.Size(), effects, ink.color, placed.bounds(), placed.quote, placed.author, placed.details);
+	return ink;
+}
+
+// composeClassicImage draws the text over classicBackground. the text's
+// colour is picked from what's under it unless ink is given, so gif frames
+// can all share one.
+func composeClassicImage(
+	img image.Image,
+	gradient image.Image,
+	frame classicFrame,
+	quote layout.Block,
+	author layout.Block,
+	details layout.Block,
+	theme Theme,
+	contrast Contrast,
+	effects Effects,
+	watermark *Watermark,
+	ink *textInk,
+) *gg.Context {
+	placed := frame.place(quote, author, details);
+	dc := classicBackground(img, gradient, frame, placed);
+	bounds := placed.bounds();
+	if ink == nil {
+		picked := classicInk(stats.Measure(dc.Image(), bounds), frame, placed, theme, contrast, effects);
+		ink = &picked;
+	}
+
+	quote_at, author_at, details_at := placed.quote, placed.author, placed.details;
+	drawBacking(dc, *ink, bounds, quote_at, author_at, details_at);
+	drawEffects(dc, *ink);
+	drawBlock(dc, quote, ink.color, quote_at.x, quote_at.y, 0, 0, quote_at.width, quote_at.align);
+	drawBlock(dc, author, pick(theme.Author, ink.color), author_at.x, author_at.y, 0, 0, author_at.width, author_at.align);
+	drawBlock(dc, details, pick(theme.Author, ink.color), details_at.x, details_at.y, 0, 0, details_at.width, details_at.align);
+	drawWatermark(dc, watermark);
+
+	return dc;
+}
@@ -0,0 +1,55 @@
+package styles
+
+import (
+	"image"
+	"strings"
+	"testing"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+
+	"canvas/lib/layout"
+)
+
+// goFaces is the go fonts at size.
+func goFaces(t *testing.T, size float64) layout.Faces {
+	t.Helper();
+	face := func(data []byte) font.Face {
+		f, err := opentype.Parse(data);
+		if err != nil {
+			t.Fatal(err);
+		}
+		face, err := opentype.NewFace(f, &opentype.FaceOptions{ Size: size, DPI: 72, Hinting: font.HintingFull });
+		if err != nil {
+			t.Fatal(err);
+		}
+		return face;
+	};
+	return layout.Faces{ Regular: face(goregular.TTF), Bold: face(gobold.TTF), Size: size };
+}
+
+// without fit, a long quote is cut to what fits above the author line, with
+// the attachment under it, not just to the line limit.
+func TestClassicBlocksFitTheBand(t *testing.T) {
+	quote := []layout.Run{ { Text: strings.Repeat("a long quote that goes on and on ", 40) } };
+	author := []layout.Run{ { Text: "- Someone" } };
+	details := []layout.Run{ { Text: "#general, 2024" } };
+	for _, position := range []string{ "", "beside" } {
+		for _, size := range []float64{ 20, 36, 60 } {
+			frame := newClassicFrame(image.Pt(1280, 720), Placement{}, &Attachment{ Image: image.NewRGBA(image.Rect(0, 0, 400, 300)), Position: position });
+			faces := goFaces(t, size);
+			quote_block, author_block, details_block := classicBlocks(quote, author, details, faces, goFaces(t, size * 0.7), frame, 9, nil);
+			if len(quote_block.Lines) == 0 || len(quote_block.Lines) > 9 {
+				t.Fatalf("attachment %q size %g: got %d lines, want 1 to 9", position, size, len(quote_block.Lines));
+			}
+			box := frame.attachment;
+			height := box.besideHeight(quote_block.Height) + box.below() + authorGap(author_block) + author_block.Height + authorGap(details_block) + details_block.Height;
+			band := frame.text_bottom - frame.text_top - 2 * classic_margin * frame.scale;
+			if len(quote_block.Lines) > 1 && height > band {
+				t.Errorf("attachment %q size %g: the column is %g tall with %d quote lines, the band is %g", position, size, height, len(quote_block.Lines), band);
+			}
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package styles
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"math"
+	"strings"
+
+	"github.com/fogleman/gg"
+
+	"canvas/lib/layout"
+	"canvas/lib/stats"
+)
+
+// Contrast keeps text readable over whatever is under it. The text colour,
+// when the theme doesn't set one, is black or white, whichever stands out
+// more from the picture under the text. If even that falls short of
+// MinRatio, Fallback is drawn behind the text.
+type Contrast struct {
+	MinRatio float64 // WCAG contrast ratio, 0 means 4.5
+	Fallback string // "shadow", "plate" or "none", empty is shadow
+}
+
+var ContrastFallbacks = []string{ "shadow", "plate", "none" };
+
+// WCAG AA for normal text.
+const default_min_ratio = 4.5;
+
+func (c Contrast) Validate() error {
+	if c.MinRatio != 0 && (c.MinRatio < 1 || c.MinRatio > 21) {
+		return fmt.Errorf("min contrast ratio has to be between 1 and 21, got %g", c.MinRatio);
+	}
+	if c.Fallback == "" {
+		return nil;
+	}
+	for _, f := range ContrastFallbacks {
+		if c.Fallback == f {
+			return nil;
+		}
+	}
+	return fmt.Errorf("unknown contrast fallback %q, have: %s", c.Fallback, strings.Join(ContrastFallbacks, ", "));
+}
+
+// textInk is what text gets drawn with.
+type textInk struct {
+	color color.Color
+	backing string // "" for nothing, or "shadow" or "plate"
+	backing_color color.Color
+	effects *image.RGBA // outline, shadow and glow, see effectLayer
+}
+
+// worstRatio is the contrast of c against the background pixel that's
+// closest to it in brightness.
+func worstRatio(c color.Color, low, high float64) float64 {
+	l := stats.Luminance(c);
+	switch {
+	case l >= high:
+		return stats.ContrastRatio(l, high);
+	case l <= low:
+		return stats.ContrastRatio(l, low);
+	}
+	return 1;
+}
+
+// pickInk picks how to draw text over a picture measured as under.
+// preferred, when it's set, is kept even if it's hard to read, and just
+// gets a backing.
+func pickInk(under stats.Region, preferred color.Color, contrast Contrast) textInk {
+	low, high := under.Low, under.High;
+	ink := textInk{ color: preferred };
+	if ink.color == nil {
+		ink.color = color.White;
+		if worstRatio(color.Black, low, high) > worstRatio(color.White, low, high) {
+			ink.color = color.Black;
+		}
+	}
+
+	min_ratio := contrast.MinRatio;
+	if min_ratio == 0 {
+		min_ratio = default_min_ratio;
+	}
+	if worstRatio(ink.color, low, high) >= min_ratio || contrast.Fallback == "none" {
+		return ink;
+	}
+
+	ink.backing = contrast.Fallback;
+	if ink.backing == "" {
+		ink.backing = "shadow";
+	}
+	ink.backing_color = contrastingColor(ink.color);
+	return ink;
+}
+
+// how many frames, spread through a gif, are measured to pick its ink.
+const gif_ink_samples = 8;
+
+// measureGif measures what's under bounds as src plays, to pick one ink
+// that reads on every frame. frames are drawn over each other, and
+// background turns the picture so far into what the text goes over.
+func measureGif(src *gif.GIF, bounds image.Rectangle, background func(canvas image.Image) image.Image) stats.Region {
+	canvas := image.NewRGBA(image.Rect(0, 0, src.Config.Width, src.Config.Height));
+	step := max(1, (len(src.Image) + gif_ink_samples - 1) / gif_ink_samples);
+	var frames []image.Image;
+	for i, frame := range src.Image {
+		draw.Draw(canvas, frame.Rect, frame, frame.Rect.Min, draw.Over);
+		if i % step != 0 {
+			continue;
+		}
+		// only the part under the text is kept.
+		under := image.NewRGBA(bounds);
+		draw.Draw(under, bounds, background(canvas), bounds.Min, draw.Src);
+		frames = append(frames, under);
+	}
+	return stats.MeasureFrames(frames, bounds);
+}
+
+// contrastingColor is whichever of black and white is further from c.
+func contrastingColor(c color.Color) color.Color {
+	l := stats.Luminance(c);
+	if stats.ContrastRatio(l, 1) > stats.ContrastRatio(l, 0) {
+		return color.White;
+	}
+	return color.Black;
+}
+
+// drawBacking draws the ink's backing for text covering bounds. plates go
+// under the whole box, shadows under each block given.
+func drawBacking(dc *gg.Context, ink textInk, bounds image.Rectangle, blocks ...placedBlock) {
+	switch ink.backing {
+	case "plate":
+		r, g, b, _ := ink.backing_color.RGBA();
+		pad := float64(bounds.Dy()) * 0.06 + 8;
+		dc.SetRGBA255(int(r >> 8), int(g >> 8), int(b >> 8), 190);
+		dc.DrawRoundedRectangle(float64(bounds.Min.X) - pad, float64(bounds.Min.Y) - pad, float64(bounds.Dx()) + 2 * pad, float64(bounds.Dy()) + 2 * pad, pad);
+		dc.Fill();
+	case "shadow":
+		for _, placed := range blocks {
+			if len(placed.block.Lines) == 0 {
+				continue;
+			}
+			offset := math.Max(1, placed.block.Lines[0].Height / 24);
+			drawBlock(dc, shadowOf(placed.block), ink.backing_color, placed.x + offset, placed.y + offset, 0, 0, placed.width, placed.align);
+		}
+	}
+}
+
+// placedBlock is a block with where drawBlock puts it.
+type placedBlock struct {
+	block layout.Block
+	x, y, width float64
+	align Align
+}
+
+// bounds is the pixel rectangle the block's lines cover.
+func (placed placedBlock) bounds() image.Rectangle {
+	left, right := math.Inf(1), math.Inf(-1);
+	for _, line := range placed.block.Lines {
+		line_width := line.Width;
+		offset := 0.0;
+		switch placed.align {
+		case AlignCenter:
+			offset = (placed.width - line.Width) / 2;
+		case AlignRight:
+			offset = placed.width - line.Width;
+		case AlignJustify:
+			if !line.Last {
+				line_width = max(line_width, placed.width);
+			}
+		}
+		left = math.Min(left, placed.x + offset);
+		right = math.Max(right, placed.x + offset + line_width);
+	}
+	if left > right {
+		return image.Rectangle{};
+	}
+	return image.Rect(int(left), int(placed.y), int(math.Ceil(right)), int(math.Ceil(placed.y + placed.block.Height)));
+}
+
+// textBounds is what all of blocks cover together.
+func textBounds(blocks ...placedBlock) image.Rectangle {
+	var bounds image.Rectangle;
+	for _, placed := range blocks {
+		bounds = bounds.Union(placed.bounds());
+	}
+	return bounds;
+}
+
+// shadowOf is block in one colour. spoilers are left out, their boxes
+// already hide what's under them.
+func shadowOf(block layout.Block) layout.Block {
+	shadow := block;
+	shadow.Lines = make([]layout.LineBox, len(block.Lines));
+	for i, line := range block.Lines {
+		var pieces []layout.Piece;
+		for _, piece := range line.Pieces {
+			if piece.Style.Spoiler {
+				continue;
+			}
+			piece.Style.Color = nil;
+			pieces = append(pieces, piece);
+		}
+		line.Pieces = pieces;
+		shadow.Lines[i] = line;
+	}
+	return shadow;
+}
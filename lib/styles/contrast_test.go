@@ -0,0 +1,66 @@
+package styles
+
+import (
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"testing"
+)
+
+// solidGif is a w x h gif with a frame of each of colors.
+func solidGif(w, h int, colors ...color.Color) *gif.GIF {
+	src := &gif.GIF{ Config: image.Config{ Width: w, Height: h } };
+	for _, c := range colors {
+		frame := image.NewPaletted(image.Rect(0, 0, w, h), palette.Plan9);
+		for i := range frame.Pix {
+			frame.Pix[i] = uint8(frame.Palette.Index(c));
+		}
+		src.Image = append(src.Image, frame);
+		src.Delay = append(src.Delay, 10);
+	}
+	return src;
+}
+
+func same(canvas image.Image) image.Image {
+	return canvas;
+}
+
+// the ink is measured across the gif, not just on its first frame.
+func TestMeasureGifSeesEveryFrame(t *testing.T) {
+	src := solidGif(40, 30, color.Black, color.White, color.White, color.White);
+	under := measureGif(src, image.Rect(0, 0, 40, 30), same);
+	if under.Low != 0 || under.High != 1 {
+		t.Errorf("a black then white gif measured from %g to %g, want 0 to 1", under.Low, under.High);
+	}
+	ink := pickInk(under, nil, Contrast{});
+	if ink.backing == "" {
+		t.Errorf("no ink reads on both black and white, want a backing, got %+v", ink);
+	}
+}
+
+// long gifs are measured on frames spread through them.
+func TestMeasureGifSamplesLongGifs(t *testing.T) {
+	colors := make([]color.Color, 40);
+	for i := range colors {
+		colors[i] = color.Black;
+	}
+	colors[len(colors) - 5] = color.White;
+	under := measureGif(solidGif(10, 10, colors...), image.Rect(0, 0, 10, 10), same);
+	if under.High != 1 {
+		t.Errorf("a white frame near the end wasn't measured, high is %g", under.High);
+	}
+}
+
+// frames that only redraw part of the canvas are measured over what came
+// before them.
+func TestMeasureGifDrawsFramesOver(t *testing.T) {
+	src := solidGif(20, 20, color.White);
+	corner := image.NewPaletted(image.Rect(0, 0, 5, 5), palette.Plan9);
+	src.Image = append(src.Image, corner);
+	src.Delay = append(src.Delay, 10);
+	under := measureGif(src, image.Rect(10, 10, 20, 20), same);
+	if under.Low != 1 {
+		t.Errorf("the first frame showing through measured %g, want 1", under.Low);
+	}
+}
@@ -0,0 +1,191 @@
+package styles
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/fogleman/gg"
+
+	"canvas/lib/layout"
+	"canvas/lib/stats"
+)
+
+// Message is one message of a conversation.
+type Message struct {
+	Author []layout.Run
+	Avatar image.Image // nil gets a plain circle
+	Details []layout.Run // after the author's name, like the time it was sent
+	Text []layout.Run
+	Attachment image.Image // shown under the text, nil for none
+	Continues bool // by the same author as the one before, so it has no avatar or name
+}
+
+// ConversationWidth is the width conversations are laid out for, and drawn
+// at when no other is asked for. other widths scale from it.
+const ConversationWidth = 1000;
+
+// sizes at ConversationWidth.
+const (
+	conversation_padding = 40
+	conversation_avatar = 80
+	conversation_gutter = 24 // between the avatar and the text
+	conversation_group_gap = 28 // between one author's messages and the next's
+	conversation_message_gap = 6 // between messages by the same author
+	conversation_header_gap = 4 // between the name and the first message
+	conversation_attachment_height = 360 // the most an attachment can take up
+)
+
+// the background when the theme has no overlay, and how faint details are.
+var conversation_background = color.RGBA{ 0x31, 0x33, 0x38, 255 };
+const details_alpha = 0.6;
+
+// Conversation is a laid out conversation, ready to draw. its height
+// depends on the messages, see Size.
+type Conversation struct {
+	width int
+	height int
+	scale float64
+	items []conversationItem
+}
+
+// conversationItem is a laid out message. the header and avatar are only
+// drawn for messages that don't continue the one before.
+type conversationItem struct {
+	message Message
+	header layout.Block
+	header_y float64
+	text layout.Block
+	text_y float64
+	attachment *attachmentBox
+	attachment_y float64
+}
+
+// Size is the canvas the conversation needs.
+func (c Conversation) Size() image.Point {
+	return image.Pt(c.width, c.height);
+}
+
+// LayoutConversation stacks messages in a width pixel wide column, each
+// author's messages grouped under their avatar and name. faces should be
+// scaled for width, see ConversationScale.
+func LayoutConversation(messages []Message, width int, faces layout.Faces) Conversation {
+	scale := ConversationScale(width);
+	text_left := (conversation_padding + conversation_avatar + conversation_gutter) * scale;
+	text_width := float64(width) - text_left - conversation_padding * scale;
+
+	c := Conversation{ width: width, scale: scale };
+	y := conversation_padding * scale;
+	// the avatar hangs below the name, the next group has to clear it.
+	avatar_bottom := 0.0;
+	for i, message := range messages {
+		item := conversationItem{ message: message };
+		if !message.Continues || i == 0 {
+			item.message.Continues = false;
+			if i > 0 {
+				y = math.Max(y, avatar_bottom) + conversation_group_gap * scale;
+			}
+			header := append(boldRuns(message.Author), layout.Run{ Text: "  " });
+			header = append(header, message.Details...);
+			item.header = layout.NewBlock(layout.WrapRuns(header, text_width, faces), faces, 1.2);
+			item.header_y = y;
+			avatar_bottom = y + conversation_avatar * scale;
+			y += item.header.Height + conversation_header_gap * scale;
+		} else {
+			y += conversation_message_gap * scale;
+		}
+		item.text = layout.NewBlock(layout.WrapRuns(message.Text, text_width, faces), faces, 1.25);
+		item.text_y = y;
+		y += item.text.Height;
+		if message.Attachment != nil {
+			item.attachment = fitAttachment(&Attachment{ Image: message.Attachment }, text_width, conversation_attachment_height * scale, scale);
+			item.attachment_y = y + item.attachment.gap / 2;
+			y = item.attachment_y + item.attachment.height;
+		}
+		c.items = append(c.items, item);
+	}
+	c.height = int(math.Ceil(math.Max(y, avatar_bottom) + conversation_padding * scale));
+	return c;
+}
+
+// ConversationScale is how much bigger than the base layout a width pixel
+// wide conversation is. text sizes are multiplied by it.
+func ConversationScale(width int) float64 {
+	return float64(width) / ConversationWidth;
+}
+
+// boldRuns is runs with everything bold, for names.
+func boldRuns(runs []layout.Run) []layout.Run {
+	bold := make([]layout.Run, len(runs));
+	for i, run := range runs {
+		run.Style.Bold = true;
+		bold[i] = run;
+	}
+	return bold;
+}
+
+// DrawConversation draws c on a background of the theme's overlay colour.
+// avatars are cropped and filtered like the other styles' are.
+func DrawConversation(c Conversation, theme Theme, options RenderOptions) *gg.Context {
+	dc := gg.NewContext(c.width, c.height);
+	background := pick(theme.Overlay, conversation_background);
+	dc.SetColor(background);
+	dc.Clear();
+
+	// the background is one colour, so the ink comes from a swatch of it.
+	ink := pickInk(stats.Measure(image.NewUniform(background), image.Rect(0, 0, 1, 1)), theme.Text, options.Contrast);
+	details := fadeColor(ink.color, details_alpha);
+
+	avatar_size := int(math.Round(conversation_avatar * c.scale));
+	left := conversation_padding * c.scale;
+	text_left := (conversation_padding + conversation_avatar + conversation_gutter) * c.scale;
+	for _, item := range c.items {
+		if !item.message.Continues {
+			drawAvatarCircle(dc, item.message.Avatar, left, item.header_y, avatar_size, ink.color, options);
+			drawBlock(dc, fadeDetails(item.header, details), pick(theme.Author, ink.color), text_left, item.header_y, 0, 0, 0, AlignLeft);
+		}
+		drawBlock(dc, item.text, ink.color, text_left, item.text_y, 0, 0, 0, AlignLeft);
+		item.attachment.draw(dc, image.Pt(int(math.Round(text_left)), int(math.Round(item.attachment_y))));
+	}
+	drawWatermark(dc, options.Watermark);
+	return dc;
+}
+
+// drawAvatarCircle draws img covering a size circle with its top left at
+// x, y. without an image the circle is filled with a faint fg.
+func drawAvatarCircle(dc *gg.Context, img image.Image, x, y float64, size int, fg color.Color, options RenderOptions) {
+	r := float64(size) / 2;
+	dc.DrawCircle(x + r, y + r, r);
+	if img == nil {
+		dc.SetColor(fadeColor(fg, 0.2));
+		dc.Fill();
+		return;
+	}
+	square := image.NewRGBA(image.Rect(0, 0, size, size));
+	focus_x, focus_y := coverFocus(options.Crop, img, img.Bounds(), square.Rect);
+	drawCover(square, square.Rect, img, img.Bounds(), focus_x, focus_y);
+	filterRegion(square, square.Rect, options.Filters);
+	dc.Clip();
+	dc.DrawImage(square, int(math.Round(x)), int(math.Round(y)));
+	dc.ResetClip();
+}
+
+// fadeDetails colours the pieces of a header after the bold name c, unless
+// they have their own colour.
+func fadeDetails(block layout.Block, c color.Color) layout.Block {
+	recolored := block;
+	recolored.Lines = make([]layout.LineBox, len(block.Lines));
+	for i, line := range block.Lines {
+		pieces := make([]layout.Piece, len(line.Pieces));
+		for j, piece := range line.Pieces {
+			if !piece.Style.Bold && piece.Style.Color == nil {
+				piece.Style.Color = c;
+			}
+			pieces[j] = piece;
+		}
+		line.Pieces = pieces;
+		recolored.Lines[i] = line;
+	}
+	return recolored;
+}
+
@@ -0,0 +1,130 @@
+package styles
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"github.com/disintegration/gift"
+	"github.com/fogleman/gg"
+)
+
+// Effects are drawn around the text, under it. sizes are in pixels of the
+// canvas, and colours left nil are whichever of black and white stands out
+// from the text.
+type Effects struct {
+	Outline *Outline
+	Shadow *Shadow
+	Glow *Glow
+}
+
+// Outline is a solid edge Width pixels out from the letters.
+type Outline struct {
+	Width float64
+	Color color.Color
+}
+
+// Shadow is a copy of the text moved by X and Y and blurred by Blur, a
+// gaussian sigma.
+type Shadow struct {
+	X, Y float64
+	Blur float64
+	Color color.Color
+}
+
+// Glow is a soft halo reaching about Radius pixels out.
+type Glow struct {
+	Radius float64
+	Color color.Color
+}
+
+func (e Effects) Validate() error {
+	if e.Outline != nil && (e.Outline.Width < 0 || e.Outline.Width > 40) {
+		return fmt.Errorf("outline width has to be between 0 and 40, got %g", e.Outline.Width);
+	}
+	if e.Shadow != nil {
+		if math.Abs(e.Shadow.X) > 100 || math.Abs(e.Shadow.Y) > 100 {
+			return fmt.Errorf("shadow offset has to be between -100 and 100, got %g, %g", e.Shadow.X, e.Shadow.Y);
+		}
+		if e.Shadow.Blur < 0 || e.Shadow.Blur > 100 {
+			return fmt.Errorf("shadow blur has to be between 0 and 100, got %g", e.Shadow.Blur);
+		}
+	}
+	if e.Glow != nil && (e.Glow.Radius < 0 || e.Glow.Radius > 100) {
+		return fmt.Errorf("glow radius has to be between 0 and 100, got %g", e.Glow.Radius);
+	}
+	return nil;
+}
+
+func (e Effects) empty() bool {
+	return e.Outline == nil && e.Shadow == nil && e.Glow == nil;
+}
+
+// reach is how far past the text the effects can go.
+func (e Effects) reach() int {
+	r := 0.0;
+	if e.Outline != nil {
+		r = math.Max(r, e.Outline.Width);
+	}
+	if e.Shadow != nil {
+		r = math.Max(r, math.Max(math.Abs(e.Shadow.X), math.Abs(e.Shadow.Y)) + 3 * e.Shadow.Blur);
+	}
+	if e.Glow != nil {
+		r = math.Max(r, e.Glow.Radius / 4 + 3 * e.Glow.Radius / 2);
+	}
+	return int(math.Ceil(r)) + 2;
+}
+
+// effectLayer draws effects for blocks on a transparent layer covering just
+// the part of a size canvas they reach. it only depends on where the text
+// is, so gif frames work it out once and share it. nil when there's nothing
+// to draw.
+func effectLayer(size image.Point, effects Effects, text color.Color, bounds image.Rectangle, blocks ...placedBlock) *image.RGBA {
+	region := bounds.Inset(-effects.reach()).Intersect(image.Rectangle{ Max: size });
+	if effects.empty() || region.Empty() {
+		return nil;
+	}
+
+	// the letters in one colour, to be grown and blurred into the effects.
+	silhouette := gg.NewContext(size.X, size.Y);
+	for _, placed := range blocks {
+		drawBlock(silhouette, shadowOf(placed.block), color.White, placed.x, placed.y, 0, 0, placed.width, placed.align);
+	}
+	letters := silhouette.Image().(*image.RGBA).SubImage(region);
+
+	layer := image.NewRGBA(region);
+	paint := func(c color.Color, offset image.Point, filters ...gift.Filter) {
+		mask := image.NewRGBA(region);
+		gift.New(filters...).Draw(mask, letters);
+		draw.DrawMask(layer, region, image.NewUniform(pick(c, contrastingColor(text))), image.Point{}, mask, region.Min.Sub(offset), draw.Over);
+	};
+	if g := effects.Glow; g != nil && g.Radius > 0 {
+		paint(g.Color, image.Point{}, grow(g.Radius / 4), gift.GaussianBlur(float32(g.Radius / 2)));
+	}
+	if s := effects.Shadow; s != nil {
+		var blur []gift.Filter;
+		if s.Blur > 0 {
+			blur = append(blur, gift.GaussianBlur(float32(s.Blur)));
+		}
+		paint(s.Color, image.Pt(int(math.Round(s.X)), int(math.Round(s.Y))), blur...);
+	}
+	if o := effects.Outline; o != nil && o.Width > 0 {
+		paint(o.Color, image.Point{}, grow(o.Width));
+	}
+	return layer;
+}
+
+// grow widens the letters by about width pixels all round.
+func grow(width float64) gift.Filter {
+	return gift.Maximum(2 * int(math.Max(1, math.Round(width))) + 1, true);
+}
+
+// drawEffects puts the ink's effect layer, if it has one, on dc.
+func drawEffects(dc *gg.Context, ink textInk) {
+	if ink.effects == nil {
+		return;
+	}
+	draw.Draw(dc.Image().(*image.RGBA), ink.effects.Rect, ink.effects, ink.effects.Rect.Min, draw.Over);
+}
@@ -0,0 +1,213 @@
+package styles
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"math"
+
+	"github.com/disintegration/gift"
+
+	"canvas/lib/crop"
+	"canvas/lib/utils"
+)
+
+// the canvas the styles were first drawn on. other sizes scale from it,
+// turned on its side for portrait canvases.
+const base_long = 1280;
+const base_short = 720;
+
+// Scale is how much bigger than 1280x720, or 720x1280 for portrait, a
+// width x height canvas is, going by whichever side is tighter. text sizes
+// and margins are multiplied by it.
+func Scale(width, height int) float64 {
+	long, short := max(width, height), min(width, height);
+	return math.Min(float64(long) / base_long, float64(short) / base_short);
+}
+
+// RenderOptions are the rest of how a quote is drawn: what's done to the
+// avatar, how the text stays readable, what goes with it, and who hears
+// about a gif's progress.
+type RenderOptions struct {
+	Filters []gift.Filter // run over the avatar's part of the canvas, after scaling
+	Crop crop.Crop // which part of the avatar shows when it doesn't fit
+	Contrast Contrast // how the text stays readable over it
+	Effects Effects // drawn around the text
+	Attachment *Attachment // shown with the text, nil for none
+	Watermark *Watermark // stamped over everything, nil for none
+	Progress Progress // told as gif frames are done, nil for no one
+}
+
+// Progress is told how many of a gif's frames are done so far.
+type Progress func(done, total int)
+
+func (p Progress) report(done, total int) {
+	if p != nil {
+		p(done, total);
+	}
+}
+
+// coverScale is how much canvas has to grow to cover region.
+func coverScale(region image.Rectangle, canvas image.Rectangle) float64 {
+	return math.Max(float64(region.Dx()) / float64(canvas.Dx()), float64(region.Dy()) / float64(canvas.Dy()));
+}
+
+// coverFocus asks c which point of img, a full canvas, goes in the middle
+// of region.
+func coverFocus(c crop.Crop, img image.Image, canvas image.Rectangle, region image.Rectangle) (float64, float64) {
+	f := coverScale(region, canvas);
+	return c.Focus(img, float64(region.Dx()) / (float64(canvas.Dx()) * f), float64(region.Dy()) / (float64(canvas.Dy()) * f));
+}
+
+// drawCover draws img into region of dst, scaled so that canvas covers the
+// region, with whatever hangs over cut off. focus_x and focus_y are the
+// point of canvas, from 0 to 1, that's moved as close to the middle of the
+// region as it can go. img can be just a part of canvas, like a gif frame
+// that only redraws a corner.
+func drawCover(dst draw.Image, region image.Rectangle, img image.Image, canvas image.Rectangle, focus_x, focus_y float64) {
+	f := coverScale(region, canvas);
+	place := func(region_min, region_size, canvas_size int, focus float64) float64 {
+		size := float64(canvas_size) * f;
+		origin := float64(region_min) + float64(region_size) / 2 - focus * size;
+		return math.Min(float64(region_min), math.Max(float64(region_min + region_size) - size, origin));
+	};
+	origin_x := place(region.Min.X, region.Dx(), canvas.Dx(), focus_x);
+	origin_y := place(region.Min.Y, region.Dy(), canvas.Dy(), focus_y);
+
+	b := img.Bounds();
+	rect := image.Rect(
+		int(math.Round(origin_x + float64(b.Min.X - canvas.Min.X) * f)),
+		int(math.Round(origin_y + float64(b.Min.Y - canvas.Min.Y) * f)),
+		int(math.Round(origin_x + float64(b.Max.X - canvas.Min.X) * f)),
+		int(math.Round(origin_y + float64(b.Max.Y - canvas.Min.Y) * f)),
+	);
+	clip := rect.Intersect(region);
+	if clip.Empty() {
+		return;
+	}
+
+	var scaled image.Image = img;
+	if rect.Size() != b.Size() {
+		g := gift.New(gift.Resize(rect.Dx(), rect.Dy(), gift.LanczosResampling));
+		out := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()));
+		g.Draw(out, img);
+		scaled = out;
+	}
+	draw.Draw(dst, clip, scaled, scaled.Bounds().Min.Add(clip.Min.Sub(rect.Min)), draw.Over);
+}
+
+// filterRegion runs filters over region of img, in place.
+func filterRegion(img *image.RGBA, region image.Rectangle, filters []gift.Filter) {
+	if len(filters) == 0 {
+		return;
+	}
+	sub := img.SubImage(region);
+	g := gift.New(filters...);
+	out := image.NewRGBA(g.Bounds(sub.Bounds()));
+	g.Draw(out, sub);
+	draw.Draw(img, region, out, out.Rect.Min, draw.Src);
+}
+
+// gifQuantizer collects the colours of src's frames as they'll look once
+// filters have run, for the output's palette.
+func gifQuantizer(src *gif.GIF, filters []gift.Filter) *utils.OctreeQuantizer {
+	quantizer := utils.NewOctreeQuantizer();
+	if len(filters) == 0 {
+		utils.AddColorsToQuantizer(quantizer, src);
+		return quantizer;
+	}
+	g := gift.New(filters...);
+	for _, frame := range src.Image {
+		out := image.NewRGBA(g.Bounds(frame.Bounds()));
+		g.Draw(out, frame);
+		utils.AddImageColorsToQuantizer(quantizer, out);
+	}
+	return quantizer;
+}
+
+// addLayerColors puts the colours of a layer drawn over the frames in a
+// gif's palette. only the pixels that are mostly there count, the rest is
+// blended away.
+func addLayerColors(q *utils.OctreeQuantizer, layer *image.RGBA) {
+	for i := 0; i + 3 < len(layer.Pix); i += 4 {
+		a := layer.Pix[i+3];
+		if a < 128 {
+			continue;
+		}
+		// the layer is premultiplied, the palette isn't.
+		un := func(v uint8) int {
+			return int(v) * 255 / int(a);
+		};
+		q.AddColor(utils.NewColor(un(layer.Pix[i]), un(layer.Pix[i+1]), un(layer.Pix[i+2]), 255));
+	}
+}
+
+// addStyleColors puts what a style draws over the frames in a gif's
+// palette: the theme's and gradient's colours, and the ink with its backing
+// and effects. background is a frame with the gradient or wash over it, so
+// the colours they blend into are there too.
+func addStyleColors(q *utils.OctreeQuantizer, theme Theme, ink textInk, background image.Image, gradient ...color.Color) {
+	colors := append([]color.Color{ theme.Text, theme.Author, theme.Overlay, theme.Border, ink.color, ink.backing_color }, gradient...);
+	for _, c := range colors {
+		if c == nil {
+			continue;
+		}
+		n := color.NRGBAModel.Convert(c).(color.NRGBA);
+		q.AddColor(utils.NewColor(int(n.R), int(n.G), int(n.B), 255));
+	}
+	if ink.effects != nil {
+		addLayerColors(q, ink.effects);
+	}
+	utils.AddImageColorsToQuantizer(q, background);
+}
+
+// firstFrame is src's first frame on a canvas of its own.
+func firstFrame(src *gif.GIF) *image.RGBA {
+	canvas := image.NewRGBA(image.Rect(0, 0, src.Config.Width, src.Config.Height));
+	frame := src.Image[0];
+	draw.Draw(canvas, frame.Rect, frame, frame.Rect.Min, draw.Src);
+	return canvas;
+}
+
+// gifPalette is the palette of a gif style's frames. the solid colours text
+// and borders are drawn in get entries of their own, quantizing would
+// average them in with the avatar's and they'd come out muddy.
+type gifPalette struct {
+	colors color.Palette
+	quantizer *utils.OctreeQuantizer
+	solid map[utils.Color]uint8
+}
+
+// newGifPalette makes the palette from what's been added to quantizer, and
+// keeps the opaque ones of solid as they are.
+func newGifPalette(quantizer *utils.OctreeQuantizer, solid ...color.Color) *gifPalette {
+	p := &gifPalette{ quantizer: quantizer, solid: map[utils.Color]uint8{} };
+	var kept []utils.Color;
+	for _, c := range solid {
+		if c == nil {
+			continue;
+		}
+		n := color.NRGBAModel.Convert(c).(color.NRGBA);
+		kc := utils.NewColor(int(n.R), int(n.G), int(n.B), 255);
+		if _, seen := p.solid[kc]; seen || n.A != 255 {
+			continue;
+		}
+		p.solid[kc] = 0;
+		kept = append(kept, kc);
+	}
+	palette := quantizer.MakePalette(256 - len(kept));
+	for i, kc := range kept {
+		p.solid[kc] = uint8(len(palette) + i);
+	}
+	p.colors = utils.ConvertToColorPalette(append(palette, kept...));
+	return p;
+}
+
+// index is the palette entry c is drawn with.
+func (p *gifPalette) index(c utils.Color) uint8 {
+	if i, ok := p.solid[c]; ok {
+		return i;
+	}
+	return uint8(p.quantizer.GetPaletteIndex(c));
+}
@@ -0,0 +1,70 @@
+package styles
+
+import (
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"testing"
+
+	"canvas/lib/layout"
+	"canvas/lib/utils"
+)
+
+// colorfulGif is a w x h gif of frames fading through the whole palette,
+// more colours than a gif's palette holds.
+func colorfulGif(w, h, frames int) *gif.GIF {
+	src := &gif.GIF{ Config: image.Config{ Width: w, Height: h } };
+	for f := 0; f < frames; f++ {
+		frame := image.NewPaletted(image.Rect(0, 0, w, h), palette.Plan9);
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				frame.SetColorIndex(x, y, uint8((x + y * 3 + f * 20) % 256));
+			}
+		}
+		src.Image = append(src.Image, frame);
+		src.Delay = append(src.Delay, 10);
+		src.Disposal = append(src.Disposal, gif.DisposalBackground);
+	}
+	return src;
+}
+
+// drawsWith is whether every frame of out has a pixel of c.
+func drawsWith(out *gif.GIF, c color.Color) bool {
+	want := color.RGBAModel.Convert(c);
+	for _, frame := range out.Image {
+		found := false;
+		for _, index := range frame.Pix {
+			if color.RGBAModel.Convert(frame.Palette[index]) == want {
+				found = true;
+				break;
+			}
+		}
+		if !found {
+			return false;
+		}
+	}
+	return true;
+}
+
+// a theme's colours come out as they are, not averaged into the avatar's
+// colours by the quantizer.
+func TestGifKeepsThemeColors(t *testing.T) {
+	neon := color.RGBA{ 0x39, 0xff, 0x14, 0xff };
+	pink := color.RGBA{ 0xff, 0x2a, 0x9d, 0xff };
+	theme := Theme{ Text: neon, Author: pink, Border: pink };
+	quote := []layout.Run{ { Text: "a neon quote over a busy avatar" } };
+	author := []layout.Run{ { Text: "- Someone" } };
+	gradient := utils.Gradient{ Angle: 0, Start: 0, Stop: 1, From: color.NRGBA{ 0, 0, 0, 255 }, To: color.NRGBA{ 0, 0, 0, 0 } };
+	size := image.Pt(320, 180);
+
+	classic := ModifyClassicGif(colorfulGif(160, 160, 3), size, goFaces(t, 20), goFaces(t, 14), quote, author, nil, gradient, nil, theme, Placement{}, RenderOptions{});
+	minimalist := ModifyMinimalistGif(colorfulGif(160, 160, 3), size, goFaces(t, 20), quote, author, theme, Placement{}, RenderOptions{});
+	for name, out := range map[string]*gif.GIF{ "classic": classic, "minimalist": minimalist } {
+		for _, c := range []color.Color{ neon, pink } {
+			if !drawsWith(out, c) {
+				t.Errorf("%s: %v isn't drawn on every frame", name, c);
+			}
+		}
+	}
+}
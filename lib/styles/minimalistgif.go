@@ -4,10 +4,9 @@ import (
 	"image"
 	"image/gif"
 
-	"golang.org/x/image/font"
-
 	"github.com/fogleman/gg"
 
+	"canvas/lib/layout"
 	"canvas/lib/utils"
 )
 
@@ -17,17 +16,42 @@ type GifFrame struct {
 	index int
 }
 
-func ModifyMinimalistGif(src *gif.GIF, font *font.Face, text string) *gif.GIF {
+// ModifyMinimalistGif draws the quote and details over every frame of src
+// on a size canvas. frames are scaled to cover it when it's a different
+// size.
+func ModifyMinimalistGif(src *gif.GIF, size image.Point, faces layout.Faces, quote []layout.Run, details []layout.Run, theme Theme, placement Placement, options RenderOptions) *gif.GIF {
 	newGif := &gif.GIF{};
 
-    quantizer := utils.NewOctreeQuantizer()
-	utils.AddColorsToQuantizer(quantizer, src);
-    colorCount := 256; // colors. 256 before.
-	palette := quantizer.MakePalette(colorCount)
-	colorPalette := utils.ConvertToColorPalette(palette);
-
-	average_luminosity, _ := utils.GetAverageBrightnessOfPalettedImage(src.Image[0], src.Config.Width, src.Config.Height);
-	screenResolution := image.Rect(0, 0, src.Config.Width, src.Config.Height);
+	screenResolution := image.Rectangle{ Max: size };
+	column := newMinimalistColumn(screenResolution, placement, options.Attachment);
+    quantizer := gifQuantizer(src, options.Filters);
+	if column.attachment != nil {
+		utils.AddImageColorsToQuantizer(quantizer, column.attachment.img);
+	}
+	addWatermarkColors(quantizer, options.Watermark, size);
+
+	src_canvas := image.Rect(0, 0, src.Config.Width, src.Config.Height);
+	// the crop is picked once, from the first frame, so it doesn't jump around.
+	focus_x, focus_y := coverFocus(options.Crop, src.Image[0], src_canvas, screenResolution);
+	block := minimalistBlock(quote, faces, column);
+	details_block := minimalistBlock(details, faces, column);
+	placed := column.place(block, details_block);
+
+	// the text's ink is picked once, from what's under it across the whole
+	// gif, so it doesn't flicker and reads on every frame.
+	background := func(canvas image.Image) image.Image {
+		covered := image.NewRGBA(screenResolution);
+		drawCover(covered, screenResolution, canvas, src_canvas, focus_x, focus_y);
+		filterRegion(covered, screenResolution, options.Filters);
+		drawMinimalistBackground(gg.NewContextForRGBA(covered), column, placed, theme);
+		return covered;
+	};
+	under := measureGif(src, placed.bounds(), background);
+	ink := minimalistInk(under, size, placed, theme, options.Contrast, options.Effects);
+
+	addStyleColors(quantizer, theme, ink, background(firstFrame(src)));
+	palette := newGifPalette(quantizer, ink.color, pick(theme.Author, ink.color), pick(theme.Border, ink.color));
+	colorPalette := palette.colors;
 
 	// the reused image.
 	reusedImage := image.NewPaletted(screenResolution, colorPalette);
@@ -39,7 +63,14 @@ func ModifyMinimalistGif(src *gif.GIF, font *font.Face, text string) *gif.GIF {
 
 		regularImage := image.NewPaletted(screenResolution, colorPalette);
 
-		dc := composeMinimalistFrameGif(img, *font, text, screenResolution, average_luminosity);
+		var frame image.Image = img;
+		if screenResolution != src_canvas || len(options.Filters) > 0 {
+			covered := image.NewRGBA(screenResolution);
+			drawCover(covered, screenResolution, img, src_canvas, focus_x, focus_y);
+			filterRegion(covered, screenResolution, options.Filters);
+			frame = covered;
+		}
+		dc := composeMinimalistFrameGif(frame, block, details_block, column, screenResolution, theme, options.Contrast, options.Effects, options.Watermark, &ink);
 		dcImg := dc.Image().(*image.RGBA);
 		bounds := dcImg.Bounds();
 
@@ -56,7 +87,7 @@ func ModifyMinimalistGif(src *gif.GIF, font *font.Face, text string) *gif.GIF {
 				}
 
 				color := utils.NewColor(int(r), int(g), int(b), int(a));
-				index := quantizer.GetPaletteIndex(color);
+				index := palette.index(color);
 				// if disposalNone, then we modify the reusedImage again.
 				// when more frames gets parsed, this reusedImage gets populated more.
 				if disposal == gif.DisposalNone {
@@ -78,11 +109,12 @@ func ModifyMinimalistGif(src *gif.GIF, font *font.Face, text string) *gif.GIF {
 		}
 		newGif.Delay = append(newGif.Delay, delay);
 		newGif.Disposal = append(newGif.Disposal, 1);
+		options.Progress.report(i + 1, len(src.Image));
 	}
 
 	newGif.LoopCount = src.LoopCount;
-	newGif.Config.Height = src.Config.Height;
-	newGif.Config.Width = src.Config.Width;
+	newGif.Config.Height = size.Y;
+	newGif.Config.Width = size.X;
 	newGif.Config.ColorModel = src.Config.ColorModel;
 	newGif.BackgroundIndex = src.BackgroundIndex;
 
@@ -91,11 +123,16 @@ func ModifyMinimalistGif(src *gif.GIF, font *font.Face, text string) *gif.GIF {
 
 // this automatically adapts to the image resolutions
 func composeMinimalistFrameGif(
-	img *image.Paletted,
-	font font.Face,
-	text string, 
+	img image.Image,
+	block layout.Block,
+	details layout.Block,
+	column minimalistColumn,
 	resolution image.Rectangle,
-	average_luminosity uint32,
+	theme Theme,
+	contrast Contrast,
+	effects Effects,
+	watermark *Watermark,
+	ink *textInk,
 ) *gg.Context {
 	gifWidth := resolution.Max.X;
 	gifHeight := resolution.Max.Y;
@@ -113,28 +150,6 @@ func composeMinimalistFrameGif(
 		dc = gg.NewContextForImage(img);
 	}
 
-	r, g, b := 255, 255, 255;
-	if average_luminosity > 150 {
-		r, g, b = 0, 0, 0;
-	}
-	dc.SetFontFace(font);
-
-	offset := 10.0;
-	dc.SetRGBA255(r, g, b, 255);
-	dc.DrawRectangle(0 + offset, 0 + offset, float64(gifWidth) - (10 + offset), float64(gifHeight) - (10 + offset));
-	dc.SetLineWidth(1);
-	dc.Stroke();
-
-	dc.SetRGBA255(r, g, b, 255);
-	dc.DrawStringWrapped(
-		text,
-		float64(dc.Width()), // x
-		float64(dc.Height()) / 2, // y
-		1.1, // ax (anchor x)
-		0.5, // ay (anchor y)
-		float64(dc.Width()) / 2, // width
-		1.2, // line spacing
-		gg.AlignRight,
-	);
+	drawMinimalist(dc, block, details, column, gifWidth, gifHeight, theme, contrast, effects, watermark, ink);
 	return dc;
 }
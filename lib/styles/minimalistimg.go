@@ -3,30 +3,41 @@ package styles
 import (
 	"fmt"
 	"image"
+	"math"
 
-	"golang.org/x/image/font"
 	"github.com/fogleman/gg"
 
-	"canvas/lib/utils"
+	"canvas/lib/layout"
+	"canvas/lib/stats"
 )
 
-func ModifyMinimalistImage(src *image.Image, font *font.Face, text string) (*image.Image, error) {
+// ModifyMinimalistImage draws the quote, and the details under it, over src
+// on a size canvas. src is scaled to cover it when it's a different size.
+func ModifyMinimalistImage(src *image.Image, size image.Point, faces layout.Faces, quote []layout.Run, details []layout.Run, theme Theme, placement Placement, options RenderOptions) (*image.Image, error) {
 	switch im := (*src).(type) {
 	case *image.RGBA:
-		return modifyMinimalistRGBA(im, font, text), nil;
+		if im.Rect.Size() != size || len(options.Filters) > 0 {
+			covered := image.NewRGBA(image.Rectangle{ Max: size });
+			focus_x, focus_y := coverFocus(options.Crop, im, im.Rect, covered.Rect);
+			drawCover(covered, covered.Rect, im, im.Rect, focus_x, focus_y);
+			filterRegion(covered, covered.Rect, options.Filters);
+			im = covered;
+		}
+		return modifyMinimalistRGBA(im, faces, quote, details, theme, placement, options), nil;
 	default:
 		return nil, fmt.Errorf("Image is not of type RGBA.");
 	}
 }
 
 // for use in images.
-func modifyMinimalistRGBA(src *image.RGBA, font *font.Face, text string) *image.Image {
+func modifyMinimalistRGBA(src *image.RGBA, faces layout.Faces, quote []layout.Run, details []layout.Run, theme Theme, placement Placement, options RenderOptions) *image.Image {
 	width, height := src.Rect.Max.X, src.Rect.Max.Y;
-
-	average_luminosity, _ := utils.GetAverageBrightnessOfRGBA(src, width, height);
 	screenResolution := image.Rect(0, 0, width, height);
 
-	dc := composeMinimalistFrameRGBA(src, *font, text, screenResolution, average_luminosity);
+	column := newMinimalistColumn(screenResolution, placement, options.Attachment);
+	block := minimalistBlock(quote, faces, column);
+	details_block := minimalistBlock(details, faces, column);
+	dc := composeMinimalistFrameRGBA(src, block, details_block, column, screenResolution, theme, options.Contrast, options.Effects, options.Watermark);
 	dcImg := dc.Image();
 
 	return &dcImg;
@@ -34,51 +45,129 @@ func modifyMinimalistRGBA(src *image.RGBA, font *font.Face, text string) *image.
 
 func composeMinimalistFrameRGBA(
 	img *image.RGBA,
-	font font.Face,
-	text string, 
+	block layout.Block,
+	details layout.Block,
+	column minimalistColumn,
 	resolution image.Rectangle,
-	average_luminosity uint32,
+	theme Theme,
+	contrast Contrast,
+	effects Effects,
+	watermark *Watermark,
 ) *gg.Context {
 	screenWidth := resolution.Max.X;
 	screenHeight := resolution.Max.Y;
 
 	dc := gg.NewContextForImage(img);
+	drawMinimalist(dc, block, details, column, screenWidth, screenHeight, theme, contrast, effects, watermark, nil);
+	return dc;
+}
 
-	var r, g, b int;
-	if average_luminosity > 150 {
-		r = 0;
-		g = 0;
-		b = 0;
-	} else {
-		r = 255;
-		g = 255;
-		b = 255;
+// minimalistPlaced is where the quote, details and attachment go.
+type minimalistPlaced struct {
+	quote, details placedBlock
+	attachment image.Point
+}
+
+// place puts the details half a line under the quote, or under the
+// attachment when it's below, and places them together.
+func (column minimalistColumn) place(block layout.Block, details layout.Block) minimalistPlaced {
+	box := column.attachment;
+	text_width := box.textWidth(column.width);
+	gap := authorGap(details);
+	y := column.placement.anchorY(column.top, column.bottom, column.margin, box.besideHeight(block.Height) + box.below() + gap + details.Height);
+	// attachments beside the quote go on the side away from the avatar.
+	text_left, quote_y, under, attachment_at := box.place(column.left, column.width, y, block.Height, column.align, column.placement.Avatar != "right");
+	return minimalistPlaced{
+		quote: placedBlock{ block, text_left, quote_y, text_width, column.align },
+		details: placedBlock{ details, text_left, under + gap, text_width, column.align },
+		attachment: attachment_at,
+	};
+}
+
+func (placed minimalistPlaced) bounds() image.Rectangle {
+	return textBounds(placed.quote, placed.details);
+}
+
+// drawMinimalistBackground puts the overlay wash and the attachment on a
+// frame, everything that goes under the text.
+func drawMinimalistBackground(dc *gg.Context, column minimalistColumn, placed minimalistPlaced, theme Theme) {
+	if theme.Overlay != nil {
+		dc.SetColor(washColor(theme.Overlay));
+		dc.DrawRectangle(0, 0, float64(dc.Width()), float64(dc.Height()));
+		dc.Fill();
 	}
+	column.attachment.draw(dc, placed.attachment);
+}
+
+// minimalistInk picks the text's ink for a background measured as under.
+func minimalistInk(under stats.Region, size image.Point, placed minimalistPlaced, theme Theme, contrast Contrast, effects Effects) textInk {
+	ink := pickInk(under, theme.Text, contrast);
+	ink.effects = effectLayer(size, effects, ink.color, placed.bounds(), placed.quote, placed.details);
+	return ink;
+}
 
-	dc.SetFontFace(font);
+// drawMinimalist puts the overlay wash, the border, the quote and the
+// details under it on a frame.
+// the text's colour is picked from what's under it unless ink is given, so
+// gif frames can all share one.
+func drawMinimalist(dc *gg.Context, block layout.Block, details layout.Block, column minimalistColumn, screenWidth, screenHeight int, theme Theme, contrast Contrast, effects Effects, watermark *Watermark, ink *textInk) {
+	placed := column.place(block, details);
+	drawMinimalistBackground(dc, column, placed, theme);
+	bounds := placed.bounds();
+	if ink == nil {
+		picked := minimalistInk(stats.Measure(dc.Image(), bounds), image.Pt(screenWidth, screenHeight), placed, theme, contrast, effects);
+		ink = &picked;
+	}
 
 	offset := 10.0;
-	dc.SetRGBA255(r, g, b, 255);
+	dc.SetColor(pick(theme.Border, ink.color));
 	dc.DrawRectangle(0 + offset, 0 + offset, float64(screenWidth) - (10 + offset), float64(screenHeight) - (10 + offset));
 	dc.SetLineWidth(1);
 	dc.Stroke();
 
-	dc.SetRGBA255(r, g, b, 255);
-	dc.DrawStringWrapped(
-		text,
-		float64(dc.Width()), // x
-		float64(dc.Height()) / 2, // y
-		/*
-			The anchor point is x - w * ax, y - h * ay, 
-				where w, h is the size of the image. 
-			Use ax=0.5, ay=0.5 to center 
-				the image at the specified point.
-		*/
-		1.1, // ax (anchor x)
-		0.5, // ay (anchor y)
-		float64(dc.Width()) / 2, // width
-		1.2, // line spacing
-		gg.AlignRight,
-	);
-	return dc;
+	quote_at, details_at := placed.quote, placed.details;
+	drawBacking(dc, *ink, bounds, quote_at, details_at);
+	drawEffects(dc, *ink);
+	drawBlock(dc, block, ink.color, quote_at.x, quote_at.y, 0, 0, quote_at.width, quote_at.align);
+	drawBlock(dc, details, pick(theme.Author, ink.color), details_at.x, details_at.y, 0, 0, details_at.width, details_at.align);
+	drawWatermark(dc, watermark);
+}
+
+// minimalistColumn is where minimalist text goes: the half of the canvas
+// away from the avatar's side, or the bottom half when it's on top. the
+// default is the right half, with lines pushed to the right.
+type minimalistColumn struct {
+	left float64
+	width float64
+	top float64 // the text is placed between top and bottom
+	bottom float64
+	margin float64 // kept from top and bottom when the text isn't centered
+	align Align
+	placement Placement
+	attachment *attachmentBox // shares the column, nil without one
+}
+
+func newMinimalistColumn(resolution image.Rectangle, placement Placement, attachment *Attachment) minimalistColumn {
+	w, h := float64(resolution.Dx()), float64(resolution.Dy());
+	column := minimalistColumn{
+		width: w / 2,
+		bottom: h,
+		margin: math.Min(w, h) / 12,
+		placement: placement,
+	};
+	switch placement.Avatar {
+	case "right":
+		column.left, column.align = w * 0.05, AlignLeft;
+	case "top":
+		column.left, column.width, column.top, column.align = w * 0.1, w * 0.8, h / 2, AlignCenter;
+	default:
+		column.left, column.align = w * 0.45, AlignRight;
+	}
+	column.align = placement.align(column.align);
+	column.attachment = newAttachmentBox(attachment, column.width, column.bottom - column.top - 2 * column.margin, Scale(resolution.Dx(), resolution.Dy()));
+	return column;
+}
+
+func minimalistBlock(quote []layout.Run, faces layout.Faces, column minimalistColumn) layout.Block {
+	return layout.NewBlock(layout.WrapRuns(quote, column.attachment.textWidth(column.width), faces), faces, 1.2);
 }
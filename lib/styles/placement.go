@@ -0,0 +1,79 @@
+package styles
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Placement moves things around the canvas. Empty fields keep the style's
+// own layout.
+type Placement struct {
+	// where the avatar is, the text goes on the other side: "left",
+	// "right" or "top". minimalist draws the avatar over the whole canvas,
+	// so there it only says which side the text stays clear of.
+	Avatar string
+	Align string // how lines sit in the text column, see Alignments
+	Anchor string // where the text sits in its band: "top", "middle" or "bottom"
+}
+
+var AvatarPositions = []string{ "left", "right", "top" };
+var Alignments = []string{ "left", "center", "right", "justify" };
+var Anchors = []string{ "top", "middle", "bottom" };
+
+func (p Placement) Validate() error {
+	check := func(what string, value string, allowed []string) error {
+		if value == "" {
+			return nil;
+		}
+		for _, a := range allowed {
+			if value == a {
+				return nil;
+			}
+		}
+		return fmt.Errorf("unknown %s %q, have: %s", what, value, strings.Join(allowed, ", "));
+	};
+	if err := check("avatar position", p.Avatar, AvatarPositions); err != nil {
+		return err;
+	}
+	if err := check("alignment", p.Align, Alignments); err != nil {
+		return err;
+	}
+	return check("anchor", p.Anchor, Anchors);
+}
+
+// Align is how lines sit in their column.
+type Align int
+
+const (
+	AlignLeft Align = iota
+	AlignCenter
+	AlignRight
+	AlignJustify
+)
+
+// align is p.Align, or fallback when it's empty.
+func (p Placement) align(fallback Align) Align {
+	switch p.Align {
+	case "left":
+		return AlignLeft;
+	case "center":
+		return AlignCenter;
+	case "right":
+		return AlignRight;
+	case "justify":
+		return AlignJustify;
+	}
+	return fallback;
+}
+
+// anchorY is where a block of height goes in the band from top to bottom,
+// keeping margin from its edges when it's not in the middle.
+func (p Placement) anchorY(top, bottom, margin, height float64) float64 {
+	switch p.Anchor {
+	case "top":
+		return top + margin;
+	case "bottom":
+		return bottom - margin - height;
+	}
+	return top + (bottom - top - height) / 2;
+}
@@ -0,0 +1,84 @@
+package styles
+
+import (
+	"image/color"
+	"math"
+
+	"github.com/fogleman/gg"
+
+	"canvas/lib/layout"
+)
+
+// what a discord spoiler looks like before it's clicked.
+var spoiler_color = color.RGBA{ 0x20, 0x22, 0x25, 255 };
+
+// drawBlock draws a laid out block of text in fg. the anchor works like
+// gg's: x - ax * width, y - ay * block height is the block's top left.
+// justified lines fill width, except the last one of each paragraph.
+func drawBlock(dc *gg.Context, block layout.Block, fg color.Color, x, y, ax, ay, width float64, align Align) {
+	x -= ax * width;
+	y -= ay * block.Height;
+	for _, line := range block.Lines {
+		line_x := x;
+		switch align {
+		case AlignCenter:
+			line_x += (width - line.Width) / 2;
+		case AlignRight:
+			line_x += width - line.Width;
+		case AlignJustify:
+			if !line.Last {
+				line.Line = line.Line.Justify(width);
+			}
+		}
+		for _, piece := range line.Pieces {
+			drawPiece(dc, piece, fg, line_x + piece.X, y + line.Baseline);
+		}
+	}
+}
+
+// drawPiece draws a piece of a line with its baseline at y.
+func drawPiece(dc *gg.Context, piece layout.Piece, fg color.Color, x, y float64) {
+	if piece.Style.Color != nil {
+		fg = piece.Style.Color;
+	}
+	metrics := piece.Face.Metrics();
+	ascent := float64(metrics.Ascent) / 64;
+	descent := float64(metrics.Descent) / 64;
+	height := float64(metrics.Height) / 64;
+	thickness := math.Max(1, math.Round(height / 20));
+	// boxes are one line tall so they never cover the lines around them.
+	box_top := y - (height - descent);
+
+	if piece.Style.Code {
+		r, g, b, _ := fg.RGBA();
+		dc.SetRGBA255(int(r >> 8), int(g >> 8), int(b >> 8), 40);
+		dc.DrawRoundedRectangle(x - 2, box_top, piece.Width + 4, height, 4);
+		dc.Fill();
+	}
+
+	dc.SetFontFace(piece.Face);
+	dc.SetColor(fg);
+	dc.Push();
+	if piece.FakeItalic {
+		dc.ShearAbout(-0.2, 0, x, y);
+	}
+	dc.DrawString(piece.Text, x, y);
+	if piece.FakeBold {
+		dc.DrawString(piece.Text, x + thickness, y);
+	}
+	dc.Pop();
+
+	if piece.Style.Underline {
+		dc.DrawRectangle(x, y + descent / 2, piece.Width, thickness);
+		dc.Fill();
+	}
+	if piece.Style.Strike {
+		dc.DrawRectangle(x, y - ascent * 0.3, piece.Width, thickness);
+		dc.Fill();
+	}
+	if piece.Style.Spoiler {
+		dc.SetColor(spoiler_color);
+		dc.DrawRoundedRectangle(x - 2, box_top, piece.Width + 4, height, 4);
+		dc.Fill();
+	}
+}
@@ -0,0 +1,42 @@
+package styles
+
+import (
+	"image/color"
+)
+
+// Theme is the colours a style draws with. Any colour left nil is up to the
+// style: text is whichever of black or white pickInk finds has the better
+// WCAG contrast ratio against the image behind it.
+type Theme struct {
+	Text color.Color
+	Author color.Color // defaults to Text
+	Overlay color.Color // the classic gradient, or a wash under minimalist text
+	Border color.Color // minimalist's frame, defaults to Text
+}
+
+// pick returns c, or fallback when c is nil.
+func pick(c color.Color, fallback color.Color) color.Color {
+	if c == nil {
+		return fallback;
+	}
+	return c;
+}
+
+// how much of the overlay colour minimalist washes over the whole frame.
+const minimalist_wash = 0.35;
+
+// washColor scales c's alpha down to a light wash.
+func washColor(c color.Color) color.Color {
+	return fadeColor(c, minimalist_wash);
+}
+
+// fadeColor is c at alpha times its opacity.
+func fadeColor(c color.Color, alpha float64) color.Color {
+	r, g, b, a := c.RGBA();
+	return color.RGBA64{
+		uint16(float64(r) * alpha),
+		uint16(float64(g) * alpha),
+		uint16(float64(b) * alpha),
+		uint16(float64(a) * alpha),
+	};
+}
@@ -0,0 +1,163 @@
+package styles
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strings"
+
+	"github.com/disintegration/gift"
+	"github.com/fogleman/gg"
+
+	"canvas/lib/layout"
+	"canvas/lib/utils"
+)
+
+// Watermark is a name or logo stamped in a corner of every quote, over
+// everything else. it can have text, an image or both, the image first.
+type Watermark struct {
+	Text string
+	Faces layout.FacesAt // for the text
+	Image image.Image
+	Color color.Color // of the text, nil is white
+	Position string // one of WatermarkPositions, empty is bottom-right
+	Opacity float64 // 0 to 1
+	Scale float64 // size next to the default, 0 means 1
+
+	// the drawn watermark, kept for every frame of a gif.
+	layer *image.RGBA
+	layer_for image.Point
+}
+
+var WatermarkPositions = []string{ "top-left", "top-right", "bottom-left", "bottom-right", "center" };
+
+func (w *Watermark) Validate() error {
+	if w.Text == "" && w.Image == nil {
+		return fmt.Errorf("a watermark needs text or an image");
+	}
+	if w.Opacity < 0 || w.Opacity > 1 {
+		return fmt.Errorf("watermark opacity has to be between 0 and 1, got %g", w.Opacity);
+	}
+	if w.Scale < 0 || w.Scale > 4 {
+		return fmt.Errorf("watermark scale has to be between 0 and 4, got %g", w.Scale);
+	}
+	switch w.Position {
+	case "", "top-left", "top-right", "bottom-left", "bottom-right", "center":
+		return nil;
+	}
+	return fmt.Errorf("unknown watermark position %q, have: %s", w.Position, strings.Join(WatermarkPositions, ", "));
+}
+
+// sizes at 720p.
+const (
+	watermark_text_size = 24
+	watermark_image_height = 40
+	watermark_margin = 20
+	watermark_gap = 10 // between the image and the text
+)
+
+// long watermark text wraps to the canvas, and is cut after this many lines.
+const watermark_lines = 2;
+
+// drawn builds the watermark for a size canvas: the layer, and where its
+// top left goes.
+func (w *Watermark) drawn(size image.Point) (*image.RGBA, image.Point) {
+	if w.layer == nil || w.layer_for != size {
+		w.layer, w.layer_for = w.render(size), size;
+	}
+	margin := int(math.Round(watermark_margin * Scale(size.X, size.Y)));
+	free := size.Sub(w.layer.Rect.Size());
+	at := image.Pt(free.X - margin, free.Y - margin);
+	switch w.Position {
+	case "top-left":
+		at = image.Pt(margin, margin);
+	case "top-right":
+		at.Y = margin;
+	case "bottom-left":
+		at.X = margin;
+	case "center":
+		at = free.Div(2);
+	}
+	return w.layer, at;
+}
+
+// render draws the watermark for a size canvas at its own size, with the
+// opacity applied.
+func (w *Watermark) render(size image.Point) *image.RGBA {
+	canvas_scale := Scale(size.X, size.Y);
+	scale := canvas_scale;
+	if w.Scale > 0 {
+		scale *= w.Scale;
+	}
+	var logo *image.RGBA;
+	if w.Image != nil {
+		b := w.Image.Bounds();
+		h := max(1, int(math.Round(watermark_image_height * scale)));
+		width := max(1, int(math.Round(float64(b.Dx()) * float64(h) / float64(b.Dy()))));
+		logo = image.NewRGBA(image.Rect(0, 0, width, h));
+		gift.New(gift.Resize(width, h, gift.LanczosResampling)).Draw(logo, w.Image);
+	}
+
+	// the logo and text sit side by side, lined up on their middles.
+	shadow := math.Max(1, scale);
+	has_text := w.Text != "" && w.Faces != nil;
+	text_x := 0.0;
+	if logo != nil {
+		text_x = float64(logo.Rect.Dx());
+		if has_text {
+			text_x += watermark_gap * scale;
+		}
+	}
+	var block layout.Block;
+	if has_text {
+		faces := w.Faces(watermark_text_size * scale);
+		room := math.Max(1, float64(size.X) - 2 * watermark_margin * canvas_scale - text_x - shadow);
+		lines := layout.WrapRuns([]layout.Run{ { Text: w.Text } }, room, faces);
+		block = layout.NewBlock(layout.TruncateLines(lines, watermark_lines, room, faces), faces, 1);
+	}
+	width, height := 0.0, block.Height;
+	if logo != nil {
+		width = float64(logo.Rect.Dx());
+		height = math.Max(height, float64(logo.Rect.Dy()));
+	}
+	for _, line := range block.Lines {
+		width = math.Max(width, text_x + line.Width + shadow);
+	}
+	dc := gg.NewContext(max(1, int(math.Ceil(width))), max(1, int(math.Ceil(height + shadow))));
+	if logo != nil {
+		dc.DrawImage(logo, 0, int(math.Round((height - float64(logo.Rect.Dy())) / 2)));
+	}
+	if len(block.Lines) > 0 {
+		text_y := (height - block.Height) / 2;
+		drawBlock(dc, shadowOf(block), color.RGBA{ 0, 0, 0, 128 }, text_x + shadow, text_y + shadow, 0, 0, 0, AlignLeft);
+		drawBlock(dc, block, pick(w.Color, color.White), text_x, text_y, 0, 0, 0, AlignLeft);
+	}
+
+	layer := dc.Image().(*image.RGBA);
+	opacity := w.Opacity;
+	for i := range layer.Pix {
+		layer.Pix[i] = uint8(float64(layer.Pix[i]) * opacity + 0.5);
+	}
+	return layer;
+}
+
+// drawWatermark stamps w, when there is one, on dc.
+func drawWatermark(dc *gg.Context, w *Watermark) {
+	if w == nil {
+		return;
+	}
+	img := dc.Image().(*image.RGBA);
+	layer, at := w.drawn(img.Rect.Size());
+	draw.Draw(img, layer.Rect.Add(at), layer, image.Point{}, draw.Over);
+}
+
+// addWatermarkColors puts the watermark's colours in a gif's palette.
+func addWatermarkColors(q *utils.OctreeQuantizer, w *Watermark, size image.Point) {
+	if w == nil {
+		return;
+	}
+	layer, _ := w.drawn(size);
+	addLayerColors(q, layer);
+}
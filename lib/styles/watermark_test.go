@@ -0,0 +1,30 @@
+package styles
+
+import (
+	"image"
+	"strings"
+	"testing"
+
+	"canvas/lib/layout"
+)
+
+// long watermark text wraps, and is cut, to stay on the canvas, words too
+// long for a line included.
+func TestWatermarkFitsTheCanvas(t *testing.T) {
+	faces_at := func(size float64) layout.Faces {
+		return goFaces(t, size);
+	};
+	texts := []string{
+		strings.Repeat("a watermark that goes on ", 20),
+		strings.Repeat("x", 300),
+	};
+	for _, text := range texts {
+		for _, size := range []image.Point{ image.Pt(1280, 720), image.Pt(320, 180), image.Pt(180, 320) } {
+			w := &Watermark{ Text: text, Faces: faces_at, Opacity: 1, Image: image.NewRGBA(image.Rect(0, 0, 40, 40)) };
+			layer, at := w.drawn(size);
+			if at.X < 0 || at.Y < 0 || at.X + layer.Rect.Dx() > size.X || at.Y + layer.Rect.Dy() > size.Y {
+				t.Errorf("%.10s... on %v: a %v layer at %v is off the canvas", text, size, layer.Rect.Size(), at);
+			}
+		}
+	}
+}
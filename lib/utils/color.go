@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"fmt"
+	"image/color"
+	"strconv"
+	"strings"
+)
+
+// ParseHexColor reads "#rgb", "#rrggbb" or "#rrggbbaa", the # is optional.
+func ParseHexColor(s string) (color.RGBA, error) {
+	c, err := ParseHexNRGBA(s);
+	if err != nil {
+		return color.RGBA{}, err;
+	}
+	// image/color wants premultiplied alpha.
+	return color.RGBAModel.Convert(c).(color.RGBA), nil;
+}
+
+// ParseHexNRGBA is ParseHexColor without premultiplying, for colours that
+// get blended by hand.
+func ParseHexNRGBA(s string) (color.NRGBA, error) {
+	hex := strings.TrimPrefix(s, "#");
+	if len(hex) == 3 {
+		hex = string([]byte{ hex[0], hex[0], hex[1], hex[1], hex[2], hex[2] });
+	}
+	if len(hex) == 6 {
+		hex += "ff";
+	}
+	if len(hex) != 8 {
+		return color.NRGBA{}, fmt.Errorf("%q is not a hex colour", s);
+	}
+	v, err := strconv.ParseUint(hex, 16, 32);
+	if err != nil {
+		return color.NRGBA{}, fmt.Errorf("%q is not a hex colour", s);
+	}
+	return color.NRGBA{ uint8(v >> 24), uint8(v >> 16), uint8(v >> 8), uint8(v) }, nil;
+}
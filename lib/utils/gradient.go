@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+// Gradient is a linear fade between two colours, drawn at any size.
+type Gradient struct {
+	Angle float64 // in degrees, 0 fades left to right and 90 top to bottom
+	Start float64 // where along the direction the fade starts, 0 to 1
+	Stop float64 // and where it ends
+	From color.NRGBA // colour up to Start
+	To color.NRGBA // colour from Stop on
+	Curve string // how the fade eases, see GradientCurves
+}
+
+// GradientCurves maps a curve name to how far along the fade t is.
+var GradientCurves = map[string]func(t float64) float64{
+	"linear": func(t float64) float64 { return t },
+	"ease-in": func(t float64) float64 { return t * t },
+	"ease-out": func(t float64) float64 { return 1 - (1 - t) * (1 - t) },
+	"smooth": func(t float64) float64 { return t * t * (3 - 2 * t) },
+}
+
+// the classic style's fade, black creeping in over the avatar's right half.
+var ClassicGradient = Gradient{
+	Angle: 0,
+	Start: 0.3,
+	Stop: 0.62,
+	From: color.NRGBA{ 0, 0, 0, 0 },
+	To: color.NRGBA{ 0, 0, 0, 255 },
+	Curve: "smooth",
+};
+
+func (g Gradient) Validate() error {
+	if g.Start < 0 || g.Stop > 1 || g.Start >= g.Stop {
+		return fmt.Errorf("gradient needs 0 <= start < stop <= 1, got %g and %g", g.Start, g.Stop);
+	}
+	if _, ok := GradientCurves[g.Curve]; !ok {
+		return fmt.Errorf("unknown gradient curve %q", g.Curve);
+	}
+	return nil;
+}
+
+// Render draws the gradient over a width x height image.
+func (g Gradient) Render(width int, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height));
+	curve := GradientCurves[g.Curve];
+	if curve == nil {
+		curve = GradientCurves["linear"];
+	}
+
+	rad := g.Angle * math.Pi / 180;
+	dx, dy := math.Cos(rad), math.Sin(rad);
+	// how far the corners reach along the direction, so the fade always
+	// spans the whole image whatever the angle.
+	extent := math.Abs(dx) + math.Abs(dy);
+
+	for y := 0; y < height; y++ {
+		fy := (float64(y) + 0.5) / float64(height) - 0.5;
+		for x := 0; x < width; x++ {
+			fx := (float64(x) + 0.5) / float64(width) - 0.5;
+			p := (fx * dx + fy * dy) / extent + 0.5;
+			t := math.Min(1, math.Max(0, (p - g.Start) / (g.Stop - g.Start)));
+			t = curve(t);
+
+			a := lerp(g.From.A, g.To.A, t);
+			i := img.PixOffset(x, y);
+			// premultiplied, like image.RGBA wants.
+			img.Pix[i+0] = uint8(lerp(g.From.R, g.To.R, t) * a / 255 + 0.5);
+			img.Pix[i+1] = uint8(lerp(g.From.G, g.To.G, t) * a / 255 + 0.5);
+			img.Pix[i+2] = uint8(lerp(g.From.B, g.To.B, t) * a / 255 + 0.5);
+			img.Pix[i+3] = uint8(a + 0.5);
+		}
+	}
+	return img;
+}
+
+func lerp(a uint8, b uint8, t float64) float64 {
+	return float64(a) + (float64(b) - float64(a)) * t;
+}
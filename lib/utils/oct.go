@@ -2,6 +2,7 @@ package utils
 
 import (
 	"fmt"
+	"image"
 	"image/color"
 	"image/gif"
 )
@@ -217,13 +218,19 @@ func ConvertToColorPalette(palette []Color) color.Palette {
 func AddColorsToQuantizer(q *OctreeQuantizer, g *gif.GIF) {
     // Add colors from each frame to the quantizer
     for _, frame := range g.Image {
-        bounds := frame.Bounds()
-        for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-            for x := bounds.Min.X; x < bounds.Max.X; x++ {
-                r, g, b, a := frame.At(x, y).RGBA()
-                color := NewColor(int(r>>8), int(g>>8), int(b>>8), int(a>>8))
-                q.AddColor(color) // called every pixel in every frame!
-            }
+        AddImageColorsToQuantizer(q, frame)
+    }
+}
+
+// AddImageColorsToQuantizer adds every pixel of img, for when the frames
+// are changed before they're drawn.
+func AddImageColorsToQuantizer(q *OctreeQuantizer, img image.Image) {
+    bounds := img.Bounds()
+    for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+        for x := bounds.Min.X; x < bounds.Max.X; x++ {
+            r, g, b, a := img.At(x, y).RGBA()
+            color := NewColor(int(r>>8), int(g>>8), int(b>>8), int(a>>8))
+            q.AddColor(color) // called every pixel in every frame!
         }
     }
 }
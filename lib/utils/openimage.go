@@ -2,22 +2,20 @@ package utils;
 
 import (
 	"image"
-	"os"
+	"io/fs"
 	"bufio"
 )
 
-func OpenImage(fp string) image.Image {
-	image_file, err := os.Open(fp);
+func OpenImage(fsys fs.FS, fp string) (image.Image, error) {
+	image_file, err := fsys.Open(fp);
 	if err != nil {
-		panic(err);
+		return nil, err;
 	}
+	defer image_file.Close();
 	im := bufio.NewReader(image_file);
 	decoded_im, _, err := image.Decode(im);
 	if err != nil {
-		panic(err);
+		return nil, err;
 	}
-	if err := image_file.Close(); err != nil {
-		panic(err);
-	}
-	return decoded_im;
+	return decoded_im, nil;
 }
@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"errors"
+	"io/fs"
+	"sort"
+)
+
+// OverlayFS reads from Top first and falls back to Bottom for anything
+// Top doesn't have. Directory listings are merged, with Top's entries
+// winning when both have the same name.
+type OverlayFS struct {
+	Top fs.FS
+	Bottom fs.FS
+}
+
+func (o OverlayFS) Open(name string) (fs.File, error) {
+	f, err := o.Top.Open(name);
+	if err == nil {
+		return f, nil;
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err;
+	}
+	return o.Bottom.Open(name);
+}
+
+func (o OverlayFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	top, top_err := fs.ReadDir(o.Top, name);
+	bottom, bottom_err := fs.ReadDir(o.Bottom, name);
+	if top_err != nil && !errors.Is(top_err, fs.ErrNotExist) {
+		return nil, top_err;
+	}
+	if top_err != nil && bottom_err != nil {
+		return nil, bottom_err;
+	}
+
+	seen := map[string]bool{};
+	entries := top;
+	for _, entry := range top {
+		seen[entry.Name()] = true;
+	}
+	for _, entry := range bottom {
+		if !seen[entry.Name()] {
+			entries = append(entries, entry);
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() });
+	return entries, nil;
+}
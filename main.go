@@ -3,70 +3,220 @@ package main
 import (
 	// "image"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"image"
 	"io"
+	"log"
 	"net/http"
+	"runtime"
+	"strings"
+	"time"
 
+	"canvas/lib/crop"
+	"canvas/lib/fonts"
+	"canvas/lib/layout"
 	"canvas/lib/styles"
-	"canvas/lib/utils"
-
-	"github.com/fogleman/gg"
 
 	_ "image/png"
 )
 
-var gradient = utils.OpenImage("./images/quote/qgradient.png");
-var big_classic_font, _ = gg.LoadFontFace("./fonts/Mirador-SemiBold.ttf", 25 * 2);
-var small_classic_font, _ = gg.LoadFontFace("./fonts/Mirador-BookItalic.ttf", 15 * 2);
 
-var big_classicgif_font, _ = gg.LoadFontFace("./fonts/Mirador-SemiBold.ttf", 25);
-var small_classicgif_font, _ = gg.LoadFontFace("./fonts/Mirador-BookItalic.ttf", 15);
+// every font in the assets, loaded by main before the server starts.
+var registry *fonts.Registry;
 
-var gifminimalist_font, _ = gg.LoadFontFace("./fonts/Lora-Italic.ttf", 25)
+// what each style uses when the request doesn't pick a font.
+const classic_font = "Mirador";
+const minimalist_font = "Lora";
 
+const classic_size = 25 * 2;
+const classic_author_size = 15 * 2;
 
-func getImageFromURL(url string) (image.Image, error) {
-	resp, err := http.Get(url);
-	if err != nil {
-		return nil, err;
-	}
-	defer resp.Body.Close();
+// bounds for fitted quote text, used when the request doesn't give any.
+const default_min_font_size = 28;
+const default_max_font_size = 80;
+
+// what asked for fit bounds are clamped to, in pixels.
+const min_fit_font_size = 6;
+const max_fit_font_size = 400;
+
+type Meta struct {
+	Url string `json:"avatar_url"`
+	Author string `json:"author"`
+	Text string `json:"text"`
+	Handle string `json:"handle"`
+	Timestamp string `json:"timestamp"` // RFC 3339
+	Channel string `json:"channel"`
+	Server string `json:"server"`
+	DateFormat string `json:"date_format"` // one of date_formats, or a go time layout
+	TimeZone string `json:"time_zone"` // IANA name, the timestamp's own offset when empty
+	Fit bool `json:"fit"`
+	MinFontSize float64 `json:"min_font_size"`
+	MaxFontSize float64 `json:"max_font_size"`
+	Font string `json:"font"`
+	Style string `json:"style"`
+	Theme string `json:"theme"`
+	Width int `json:"width"`
+	Height int `json:"height"`
+	Aspect string `json:"aspect"`
+	Layout LayoutMeta `json:"layout"`
+	Filters []FilterMeta `json:"filters"`
+	Crop CropMeta `json:"crop"`
+	Contrast ContrastMeta `json:"contrast"`
+	Accent AccentMeta `json:"accent"`
+	Effects EffectsMeta `json:"effects"`
+	Gradient GradientMeta `json:"gradient"`
+	Spans []Span `json:"spans"`
+	AuthorSpans []Span `json:"author_spans"`
+	Messages []MessageMeta `json:"messages"`
+	Attachment AttachmentMeta `json:"attachment"`
+	Watermark *WatermarkMeta `json:"watermark"` // only when the server allows it
+}
+
+// LayoutMeta moves the avatar and text around, see styles.Placement.
+type LayoutMeta struct {
+	Avatar string `json:"avatar"`
+	Align string `json:"align"`
+	Anchor string `json:"anchor"`
+}
+
+func (meta LayoutMeta) placement() (styles.Placement, error) {
+	p := styles.Placement{
+		Avatar: strings.ToLower(meta.Avatar),
+		Align: strings.ToLower(meta.Align),
+		Anchor: strings.ToLower(meta.Anchor),
+	};
+	return p, p.Validate();
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("bad status: %s", resp.Status);
+// CropMeta picks the part of the avatar that shows, see crop.Crop. X and Y
+// are the focal point for the focal strategy.
+type CropMeta struct {
+	Strategy string `json:"strategy"`
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+func (meta CropMeta) crop() (crop.Crop, error) {
+	c := crop.Crop{ Strategy: strings.ToLower(meta.Strategy), FocalX: meta.X, FocalY: meta.Y };
+	return c, c.Validate();
+}
+
+// AttachmentMeta is an image that came with the quoted message. Url can
+// be a data url to send the image with the request.
+type AttachmentMeta struct {
+	Url string `json:"url"`
+	Position string `json:"position"`
+}
+
+// attachment fetches the attachment, nil when there isn't one. gifs show
+// their first frame.
+func (meta AttachmentMeta) attachment(fetch *fetcher) (*styles.Attachment, error) {
+	if meta.Url == "" {
+		return nil, nil;
 	}
-	img, _, err := image.Decode(resp.Body);
-	if err != nil {
+	a := &styles.Attachment{ Position: strings.ToLower(meta.Position) };
+	if err := a.Validate(); err != nil {
 		return nil, err;
 	}
+	img, err := fetch.image(meta.Url);
+	if err != nil {
+		return nil, fmt.Errorf("Can't get attachment from URL. %w", err);
+	}
+	a.Image = img.first();
+	return a, nil;
+}
 
-	return img, nil;
+// ContrastMeta says how hard to try keeping text readable, see
+// styles.Contrast.
+type ContrastMeta struct {
+	MinRatio float64 `json:"min_ratio"`
+	Fallback string `json:"fallback"`
 }
 
-type Meta struct {
-	Url string `json:"avatar_url"`
-	Author string `json:"author"`
-	Text string `json:"text"`
+func (meta ContrastMeta) contrast() (styles.Contrast, error) {
+	c := styles.Contrast{ MinRatio: meta.MinRatio, Fallback: strings.ToLower(meta.Fallback) };
+	return c, c.Validate();
+}
+
+// fitOptions turns the fit fields of the request into style options.
+// nil means the quote keeps the fixed size and line limit. the default
+// bounds are for 720p and get multiplied by scale, asked for ones don't.
+func (meta *Meta) fitOptions(faces_at layout.FacesAt, scale float64) (*styles.FitOptions, error) {
+	if !meta.Fit {
+		return nil, nil;
+	}
+	fit := &styles.FitOptions{
+		Faces: faces_at,
+		MinSize: default_min_font_size * scale,
+		MaxSize: default_max_font_size * scale,
+	};
+	if meta.MinFontSize > 0 {
+		fit.MinSize = meta.MinFontSize;
+	}
+	if meta.MaxFontSize > 0 {
+		fit.MaxSize = meta.MaxFontSize;
+	}
+	if fit.MinSize > fit.MaxSize {
+		return nil, fmt.Errorf("min_font_size (%g) is bigger than max_font_size (%g)", fit.MinSize, fit.MaxSize);
+	}
+	// past these text is unreadable, or no quote could ever fit.
+	fit.MinSize = min(max(fit.MinSize, min_fit_font_size), max_fit_font_size);
+	fit.MaxSize = min(max(fit.MaxSize, min_fit_font_size), max_fit_font_size);
+	return fit, nil;
 }
 
-func sendClassicImage(w http.ResponseWriter, r *http.Request) {
-	reqBody, _ := io.ReadAll(r.Body);
-	var meta Meta;
+// the most a request body can be. images sent as data urls are in it, as
+// base64, so it has room for all a request's images on top of the json.
+const max_body_bytes = max_request_bytes * 4 / 3 + 1 << 20;
+const max_batch_body_bytes = max_batch_bytes * 4 / 3 + 1 << 20;
+
+// readBody reads the request's body, answering with an error when it's
+// more than limit bytes or can't be read.
+func readBody(w http.ResponseWriter, r *http.Request, limit int64) ([]byte, bool) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, limit));
+	if err != nil {
+		var too_big *http.MaxBytesError;
+		if errors.As(err, &too_big) {
+			http.Error(w, fmt.Sprintf("the request body can be up to %d MiB", limit >> 20), http.StatusRequestEntityTooLarge);
+		} else {
+			http.Error(w, "Failed to read the request body.", http.StatusBadRequest);
+		}
+		return nil, false;
+	}
+	return body, true;
+}
+
+func sendQuote(w http.ResponseWriter, r *http.Request) {
+	reqBody, ok := readBody(w, r, max_body_bytes);
+	if !ok {
+		return;
+	}
+	meta := Meta{ Gradient: defaultGradientMeta() };
 
 
 	if err := json.Unmarshal(reqBody, &meta); err != nil {
 		http.Error(w, "Failed to parse metadata.", http.StatusBadRequest);
 		return;
 	}
-	img, err := getImageFromURL(meta.Url);
+	rendered, err := renderLimited(&meta, nil, nil);
 	if err != nil {
-		http.Error(w, "Can't get image from URL. " + err.Error(), http.StatusBadRequest);
+		http.Error(w, err.Error(), statusOf(err));
 		return;
 	}
-	imgData := styles.ModifyClassicImage(meta.Text, meta.Author, img, gradient, &big_classic_font, &small_classic_font);
-	w.Header().Set("Content-Type", "image/png");
-	imgData.EncodePNG(w);
+	sendRendered(w, rendered);
+}
+
+// sendRendered writes a finished quote, with its colours when it has them.
+func sendRendered(w http.ResponseWriter, rendered *Rendered) {
+	if rendered.Palette != nil {
+		w.Header().Set("X-Palette", paletteHeader(rendered.Palette));
+	}
+	if rendered.Accent != nil {
+		w.Header().Set("X-Accent", hexColor(*rendered.Accent));
+	}
+	w.Header().Set("Content-Type", rendered.ContentType);
+	w.Write(rendered.Data);
 }
 
 func ping(w http.ResponseWriter, r *http.Request) {
@@ -74,8 +224,63 @@ func ping(w http.ResponseWriter, r *http.Request) {
 }
 
 func main() {
+	asset_dir := flag.String("assets", "", "directory with fonts/ and images/ that add to or replace the built in assets");
+	theme_file := flag.String("themes", "", "json file of named themes that add to or replace the built in ones");
+	watermark_file := flag.String("watermark", "", "json file with a watermark for every quote");
+	workers := flag.Int("workers", runtime.NumCPU(), "how many quotes can render at once");
+	job_queue := flag.Int("job_queue", 64, "how many jobs can wait to render");
+	job_ttl := flag.Duration("job_ttl", 15 * time.Minute, "how long finished jobs are kept");
+	callbacks := flag.String("callbacks", "", "comma separated url prefixes that job callbacks can go to");
+	discord_key := flag.String("discord_key", "", "the discord app's public key, in hex, to take its interactions");
+	discord_api := flag.String("discord_api", "https://discord.com/api/v10", "discord's api, where follow-ups go");
+	discord_cdn := flag.String("discord_cdn", "https://cdn.discordapp.com", "discord's cdn, where avatars come from");
+	flag.Parse();
+	setWorkers(*workers);
+
+	assets, err := openAssets(*asset_dir);
+	if err != nil {
+		log.Fatal(err);
+	}
+	registry, err = fonts.NewRegistry(assets, "fonts");
+	if err != nil {
+		log.Fatal(err);
+	}
+	if err := registry.Require(classic_font, minimalist_font); err != nil {
+		log.Fatal(err);
+	}
+	if *theme_file != "" {
+		if err := loadThemes(*theme_file); err != nil {
+			log.Fatal(err);
+		}
+	}
+	if err := checkThemes(); err != nil {
+		log.Fatal(err);
+	}
+	if *watermark_file != "" {
+		if err := loadWatermark(*watermark_file, *asset_dir); err != nil {
+			log.Fatal(err);
+		}
+	}
+
+	callback_prefixes, err := parseCallbacks(*callbacks);
+	if err != nil {
+		log.Fatal(err);
+	}
+	startJobs(*job_queue, *job_ttl, *workers, callback_prefixes);
+
 	http.HandleFunc("/ping", ping);
-	http.HandleFunc("/quote", sendClassicImage);
+	http.HandleFunc("/quote", sendQuote);
+	http.HandleFunc("/batch", sendBatch);
+	http.HandleFunc("POST /jobs", submitJob);
+	http.HandleFunc("GET /jobs/{id}", jobStatus);
+	http.HandleFunc("GET /jobs/{id}/result", jobResult);
+	if *discord_key != "" {
+		discord, err = newDiscordApp(*discord_key, *discord_api, *discord_cdn);
+		if err != nil {
+			log.Fatal(err);
+		}
+		http.HandleFunc("POST /discord/interactions", discordInteractions);
+	}
 	http.ListenAndServe(":8080", nil);
 	println("Started server on localhost:8080");
 }
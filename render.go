@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"net/http"
+
+	"canvas/lib/stats"
+	"canvas/lib/styles"
+)
+
+// badRequest is an error in what the request asked for, as opposed to one
+// in rendering it.
+type badRequest struct {
+	err error
+}
+
+func (e *badRequest) Error() string {
+	return e.err.Error();
+}
+
+func (e *badRequest) Unwrap() error {
+	return e.err;
+}
+
+func badRequestf(format string, args ...any) error {
+	return &badRequest{ fmt.Errorf(format, args...) };
+}
+
+// statusOf is the http status an error from renderQuote should get.
+func statusOf(err error) int {
+	var bad *badRequest;
+	if errors.As(err, &bad) {
+		return http.StatusBadRequest;
+	}
+	return http.StatusInternalServerError;
+}
+
+// Rendered is a finished quote, ready to send. Palette and Accent are the
+// avatar's colours, set when the request asked for them.
+type Rendered struct {
+	ContentType string
+	Data []byte
+	Palette []stats.Swatch
+	Accent *color.NRGBA
+}
+
+// avatar is the decoded avatar. Frames is set when it's an animated gif.
+type avatar struct {
+	Still image.Image
+	Frames *gif.GIF
+}
+
+// first is the still, or the first frame of a gif.
+func (a *avatar) first() image.Image {
+	if a.Frames != nil {
+		return a.Frames.Image[0];
+	}
+	return a.Still;
+}
+
+// the styles a request can pick, classic when it doesn't, or conversation
+// when it has messages.
+const (
+	style_classic = "classic"
+	style_minimalist = "minimalist"
+	style_conversation = "conversation"
+)
+
+// renderQuote draws the quote the request describes. still avatars make a
+// png, animated ones a gif. cache shares fetched images with the rest of a
+// batch, and is nil otherwise. progress hears about gif frames as they're
+// done, when it's set.
+func renderQuote(meta *Meta, cache *fetchCache, progress styles.Progress) (*Rendered, error) {
+	render, err := prepareQuote(meta, cache);
+	if err != nil {
+		return nil, err;
+	}
+	return render(progress);
+}
+
+// renderFunc draws a prepared quote.
+type renderFunc func(progress styles.Progress) (*Rendered, error)
+
+// prepareQuote checks the request and fetches and decodes its images, and
+// returns what draws it. drawing takes the cpu, the rest is mostly waiting
+// on the network.
+func prepareQuote(meta *Meta, cache *fetchCache) (renderFunc, error) {
+	style := meta.Style;
+	if style == "" && len(meta.Messages) > 0 {
+		style = style_conversation;
+	}
+	if style == "" {
+		style = style_classic;
+	}
+	if style != style_classic && style != style_minimalist && style != style_conversation {
+		return nil, badRequestf("unknown style %q, have: %s, %s, %s", style, style_classic, style_minimalist, style_conversation);
+	}
+	if (style == style_conversation) != (len(meta.Messages) > 0) {
+		return nil, badRequestf("messages go with the %s style, and it needs at least one", style_conversation);
+	}
+
+	theme_meta, err := lookupTheme(meta.Theme);
+	if err != nil {
+		return nil, &badRequest{ err };
+	}
+	theme, overlay, err := theme_meta.theme();
+	if err != nil {
+		return nil, badRequestf("theme: %w", err);
+	}
+
+	font_name := meta.Font;
+	if font_name == "" {
+		font_name = theme_meta.Font;
+	}
+	if font_name == "" && style == style_minimalist {
+		font_name = minimalist_font;
+	}
+	if font_name == "" {
+		font_name = classic_font;
+	}
+	family, err := registry.Family(font_name);
+	if err != nil {
+		return nil, &badRequest{ err };
+	}
+	author_family := family;
+	if theme_meta.AuthorFont != "" {
+		author_family, err = registry.Family(theme_meta.AuthorFont);
+		if err != nil {
+			return nil, &badRequest{ err };
+		}
+	}
+	quote_at := registry.FacesAt(family, false);
+	author_at := registry.FacesAt(author_family, true);
+	if style == style_conversation {
+		return prepareConversation(meta, style, theme, quote_at, cache);
+	}
+
+	quote, err := meta.quoteRuns();
+	if err != nil {
+		return nil, &badRequest{ err };
+	}
+	author, err := meta.authorRuns();
+	if err != nil {
+		return nil, &badRequest{ err };
+	}
+	// classic puts the handle under the author, minimalist has no author
+	// line so it goes in with the details.
+	author = meta.withHandle(author);
+	details, err := meta.detailRuns(style == style_minimalist);
+	if err != nil {
+		return nil, &badRequest{ err };
+	}
+	gradient, err := meta.Gradient.gradient(overlay);
+	if err != nil {
+		return nil, &badRequest{ err };
+	}
+	placement, err := meta.Layout.placement();
+	if err != nil {
+		return nil, &badRequest{ err };
+	}
+	accent_uses, err := meta.Accent.uses();
+	if err != nil {
+		return nil, &badRequest{ err };
+	}
+	fetch := &fetcher{ cache: cache };
+	avatar, err := fetch.image(meta.Url);
+	if err != nil {
+		return nil, badRequestf("Can't get image from URL. %w", err);
+	}
+	attachment, err := meta.Attachment.attachment(fetch);
+	if err != nil {
+		return nil, &badRequest{ err };
+	}
+	watermark, err := meta.requestWatermark(fetch, quote_at);
+	if err != nil {
+		return nil, &badRequest{ err };
+	}
+	return func(progress styles.Progress) (*Rendered, error) {
+		rendered := &Rendered{};
+		if len(accent_uses) > 0 || meta.Accent.Palette {
+			palette := avatar.palette();
+			accent, ok := stats.Accent(palette);
+			// a grey avatar has no accent, and the parts keep their colours.
+			if ok {
+				applyAccent(accent_uses, accent, &theme, &gradient);
+			}
+			if meta.Accent.Palette {
+				rendered.Palette = palette;
+				if ok {
+					rendered.Accent = &accent;
+				}
+			}
+		}
+
+		// classic stills are 720p unless asked otherwise, classic gifs keep the
+		// avatar's height so they don't get any bigger, and minimalist keeps the
+		// avatar's size.
+		var natural image.Point;
+		if avatar.Frames != nil {
+			natural = image.Point{ avatar.Frames.Config.Width, avatar.Frames.Config.Height };
+		} else {
+			natural = avatar.Still.Bounds().Size();
+		}
+		fallback := natural;
+		if style == style_classic {
+			fallback = image.Point{ 1280, 720 };
+			if avatar.Frames != nil {
+				fallback = image.Point{ natural.Y * 16 / 9, natural.Y };
+			}
+		}
+		size, err := meta.outputSize(fallback, avatar.Frames != nil);
+		if err != nil {
+			return nil, &badRequest{ err };
+		}
+		scale := styles.Scale(size.X, size.Y);
+		fit, err := meta.fitOptions(quote_at, scale);
+		if err != nil {
+			return nil, &badRequest{ err };
+		}
+		avatar_filters, err := meta.avatarFilters(style, scale);
+		if err != nil {
+			return nil, &badRequest{ err };
+		}
+		avatar_crop, err := meta.Crop.crop();
+		if err != nil {
+			return nil, &badRequest{ err };
+		}
+		contrast, err := meta.Contrast.contrast();
+		if err != nil {
+			return nil, &badRequest{ err };
+		}
+		effects, err := meta.Effects.effects(scale);
+		if err != nil {
+			return nil, &badRequest{ err };
+		}
+		options := styles.RenderOptions{ Filters: avatar_filters, Crop: avatar_crop, Contrast: contrast, Effects: effects, Attachment: attachment, Watermark: watermark, Progress: progress };
+
+		var buf bytes.Buffer;
+		if avatar.Frames != nil {
+			var out *gif.GIF;
+			if style == style_minimalist {
+				out = styles.ModifyMinimalistGif(avatar.Frames, size, quote_at(minimalistSize(size)), quote, details, theme, placement, options);
+			} else {
+				out = styles.ModifyClassicGif(avatar.Frames, size, quote_at(classic_size * scale), author_at(classic_author_size * scale), quote, author, details, gradient, fit, theme, placement, options);
+			}
+			if err := gif.EncodeAll(&buf, out); err != nil {
+				return nil, err;
+			}
+			rendered.ContentType, rendered.Data = "image/gif", buf.Bytes();
+			return rendered, nil;
+		}
+
+		var out image.Image;
+		if style == style_minimalist {
+			src := toRGBA(avatar.Still);
+			img, err := styles.ModifyMinimalistImage(&src, size, quote_at(minimalistSize(size)), quote, details, theme, placement, options);
+			if err != nil {
+				return nil, err;
+			}
+			out = *img;
+		} else {
+			out = styles.ModifyClassicImage(quote, author, details, avatar.Still, size, gradient, quote_at(classic_size * scale), author_at(classic_author_size * scale), fit, theme, placement, options).Image();
+		}
+		if err := png.Encode(&buf, out); err != nil {
+			return nil, err;
+		}
+		rendered.ContentType, rendered.Data = "image/png", buf.Bytes();
+		return rendered, nil;
+	}, nil;
+}
+
+// minimalist text is sized from the frame, it has no fixed canvas.
+func minimalistSize(size image.Point) float64 {
+	return max(12, float64(min(size.X, size.Y)) / 18);
+}
+
+func toRGBA(img image.Image) image.Image {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Rect.Min == (image.Point{}) {
+		return rgba;
+	}
+	bounds := img.Bounds();
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()));
+	draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Src);
+	return rgba;
+}
+
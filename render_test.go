@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"canvas/lib/fonts"
+)
+
+var test_setup sync.Once;
+var test_setup_err error;
+
+// setupTest loads the built in fonts once for every test that renders.
+func setupTest(t *testing.T) {
+	t.Helper();
+	test_setup.Do(func() {
+		setWorkers(4);
+		registry, test_setup_err = fonts.NewRegistry(embedded_assets, "fonts");
+		if test_setup_err == nil {
+			test_setup_err = registry.Require(classic_font, minimalist_font);
+		}
+	});
+	if test_setup_err != nil {
+		t.Fatalf("loading fonts: %v", test_setup_err);
+	}
+}
+
+// testAvatar is a width x height gradient as a data url, a gif with frames
+// frames when there's more than one.
+func testAvatar(t *testing.T, width, height, frames int) string {
+	t.Helper();
+	var buf bytes.Buffer;
+	if frames <= 1 {
+		img := image.NewRGBA(image.Rect(0, 0, width, height));
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				img.Set(x, y, color.RGBA{ uint8(x * 255 / width), uint8(y * 255 / height), 128, 255 });
+			}
+		}
+		if err := png.Encode(&buf, img); err != nil {
+			t.Fatal(err);
+		}
+		return "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes());
+	}
+	animation := &gif.GIF{};
+	for f := 0; f < frames; f++ {
+		img := image.NewPaletted(image.Rect(0, 0, width, height), palette.Plan9);
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				img.Set(x, y, color.RGBA{ uint8((x + f * 40) * 255 / (width + frames * 40)), uint8(y * 255 / height), 128, 255 });
+			}
+		}
+		animation.Image = append(animation.Image, img);
+		animation.Delay = append(animation.Delay, 10);
+	}
+	if err := gif.EncodeAll(&buf, animation); err != nil {
+		t.Fatal(err);
+	}
+	return "data:image/gif;base64," + base64.StdEncoding.EncodeToString(buf.Bytes());
+}
+
+// quotes render in parallel with every font, at many sizes, without
+// sharing faces between them. run with -race to check.
+func TestRenderQuoteParallel(t *testing.T) {
+	setupTest(t);
+	still := testAvatar(t, 200, 120, 1);
+	animated := testAvatar(t, 120, 90, 3);
+	families := registry.Families();
+	if len(families) == 0 {
+		t.Fatal("no fonts");
+	}
+
+	const n = 24;
+	var wg sync.WaitGroup;
+	errs := make(chan error, n);
+	for i := 0; i < n; i++ {
+		wg.Add(1);
+		go func(i int) {
+			defer wg.Done();
+			meta := Meta{
+				Gradient: defaultGradientMeta(),
+				Url: still,
+				Author: fmt.Sprintf("Author %d", i),
+				Text: fmt.Sprintf("Quote number %d, in **bold** and *italic*, with `code` and some more words to wrap", i),
+				Font: families[i % len(families)],
+				Width: 320 + (i % 4) * 160,
+				Height: 180 + (i % 3) * 90,
+				Fit: i % 2 == 0,
+			};
+			if i % 3 == 1 {
+				meta.Style = style_minimalist;
+			}
+			if i % 5 == 0 {
+				meta.Url, meta.Width, meta.Height = animated, 0, 0;
+			}
+			rendered, err := renderQuote(&meta, nil, nil);
+			if err != nil {
+				errs <- fmt.Errorf("quote %d: %w", i, err);
+				return;
+			}
+			if _, _, err := image.Decode(bytes.NewReader(rendered.Data)); err != nil {
+				errs <- fmt.Errorf("quote %d: %s doesn't decode: %w", i, rendered.ContentType, err);
+			}
+		}(i);
+	}
+	wg.Wait();
+	close(errs);
+	for err := range errs {
+		t.Error(err);
+	}
+}
+
+// bodies past the limit, text past what discord allows and overlong filter
+// chains are turned away before anything is drawn.
+func TestSendQuoteLimits(t *testing.T) {
+	setupTest(t);
+	send := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder();
+		sendQuote(w, httptest.NewRequest(http.MethodPost, "/quote", strings.NewReader(body)));
+		return w;
+	};
+	if w := send(strings.Repeat(" ", max_body_bytes + 1)); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized body: got %d", w.Code);
+	}
+	long := strings.Repeat("a", max_text_length + 1);
+	filters := strings.Repeat(`{"name": "grayscale"}, `, max_filters) + `{"name": "grayscale"}`;
+	for _, c := range []struct{ body, want string }{
+		{ fmt.Sprintf(`{"text": %q}`, long), "the text can be up to" },
+		{ fmt.Sprintf(`{"text": "a", "author": %q}`, long), "the author can be up to" },
+		{ fmt.Sprintf(`{"spans": [{"text": %q}, {"text": "b"}]}`, long[1:]), "the text can be up to" },
+		{ fmt.Sprintf(`{"style": "conversation", "messages": [{"author": "a", "text": %q}]}`, long), "message 0: the text" },
+		{ fmt.Sprintf(`{"text": "a", "avatar_url": %q, "filters": [%s]}`, testAvatar(t, 40, 40, 1), filters), "filter chain can have up to" },
+	} {
+		w := send(c.body);
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), c.want) {
+			t.Errorf("%.40s...: got %d %q, want 400 %q", c.body, w.Code, w.Body.String(), c.want);
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// named aspect ratios, as width:height.
+var aspects = map[string]image.Point{
+	"landscape": { 16, 9 },
+	"square": { 1, 1 },
+	"portrait": { 4, 5 },
+	"story": { 9, 16 },
+};
+
+// bounds on the output. gifs pay for every frame, so they get less room.
+const min_output_side = 64;
+const max_output_side = 2560;
+const max_output_pixels = 2560 * 1440;
+const max_gif_pixels = 1280 * 720;
+
+// parseAspect reads a named aspect or one like "3:2".
+func parseAspect(s string) (image.Point, error) {
+	if ratio, ok := aspects[strings.ToLower(s)]; ok {
+		return ratio, nil;
+	}
+	w, h, ok := strings.Cut(s, ":");
+	if ok {
+		rw, err_w := strconv.Atoi(strings.TrimSpace(w));
+		rh, err_h := strconv.Atoi(strings.TrimSpace(h));
+		if err_w == nil && err_h == nil && rw > 0 && rh > 0 {
+			return image.Point{ rw, rh }, nil;
+		}
+	}
+	return image.Point{}, fmt.Errorf("aspect %q isn't a ratio like 16:9 or one of landscape, portrait, square, story", s);
+}
+
+// outputSize is the canvas the request asks for. fallback is the size
+// when it doesn't ask for anything, and its shape is the aspect when it
+// only gives a width or a height. an aspect alone keeps fallback's short
+// side. asked for sizes out of bounds are an error, a fallback that's too
+// big is shrunk to fit.
+func (meta *Meta) outputSize(fallback image.Point, animated bool) (image.Point, error) {
+	max_pixels := max_output_pixels;
+	if animated {
+		max_pixels = max_gif_pixels;
+	}
+	if meta.Width < 0 || meta.Height < 0 {
+		return image.Point{}, fmt.Errorf("width and height can't be negative");
+	}
+	if meta.Width > 0 && meta.Height > 0 && meta.Aspect != "" {
+		return image.Point{}, fmt.Errorf("give an aspect or both width and height, not all three");
+	}
+
+	ratio := fallback;
+	if meta.Aspect != "" {
+		var err error;
+		ratio, err = parseAspect(meta.Aspect);
+		if err != nil {
+			return image.Point{}, err;
+		}
+	}
+	rw, rh := float64(ratio.X), float64(ratio.Y);
+
+	var size image.Point;
+	switch {
+	case meta.Width > 0 && meta.Height > 0:
+		size = image.Point{ meta.Width, meta.Height };
+	case meta.Width > 0:
+		size = image.Point{ meta.Width, int(math.Round(float64(meta.Width) * rh / rw)) };
+	case meta.Height > 0:
+		size = image.Point{ int(math.Round(float64(meta.Height) * rw / rh)), meta.Height };
+	case meta.Aspect != "":
+		short := float64(min(fallback.X, fallback.Y));
+		scale := short / math.Min(rw, rh);
+		size = image.Point{ int(math.Round(rw * scale)), int(math.Round(rh * scale)) };
+	default:
+		return shrinkToFit(fallback, max_pixels), nil;
+	}
+
+	if min(size.X, size.Y) < min_output_side {
+		return image.Point{}, fmt.Errorf("%dx%d is too small, sides have to be at least %d", size.X, size.Y, min_output_side);
+	}
+	if max(size.X, size.Y) > max_output_side || size.X * size.Y > max_pixels {
+		return image.Point{}, fmt.Errorf("%dx%d is too big, sides can be up to %d and the whole image up to %d pixels", size.X, size.Y, max_output_side, max_pixels);
+	}
+	return size, nil;
+}
+
+// shrinkToFit scales size down, keeping its shape, until it's in bounds.
+func shrinkToFit(size image.Point, max_pixels int) image.Point {
+	scale := math.Min(1, float64(max_output_side) / float64(max(size.X, size.Y)));
+	scale = math.Min(scale, math.Sqrt(float64(max_pixels) / float64(size.X * size.Y)));
+	if scale >= 1 {
+		return size;
+	}
+	return image.Point{
+		max(1, int(float64(size.X) * scale)),
+		max(1, int(float64(size.Y) * scale)),
+	};
+}
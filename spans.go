@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"canvas/lib/layout"
+	"canvas/lib/utils"
+)
+
+// Span is a piece of styled text in a request. Every field but Text is
+// optional.
+type Span struct {
+	Text string `json:"text"`
+	Color string `json:"color"`
+	Weight int `json:"weight"` // css style, 600 and up is bold
+	Italic bool `json:"italic"`
+	Scale float64 `json:"scale"`
+}
+
+// how far a span can be scaled from the size of its block.
+const min_span_scale = 0.25;
+const max_span_scale = 4.0;
+
+// the most text a quote, its author, or a message of a conversation can
+// have: as much as a discord message.
+const max_text_length = 4000;
+
+// checkText errors when text, or the spans that replace it, are too long.
+func checkText(what, text string, spans []Span) error {
+	length := utf8.RuneCountInString(text);
+	if len(spans) > 0 {
+		length = 0;
+		for _, span := range spans {
+			length += utf8.RuneCountInString(span.Text);
+		}
+	}
+	if length > max_text_length {
+		return fmt.Errorf("%s can be up to %d characters, got %d", what, max_text_length, length);
+	}
+	return nil;
+}
+
+func spansToRuns(spans []Span) ([]layout.Run, error) {
+	runs := make([]layout.Run, 0, len(spans));
+	for i, span := range spans {
+		style := layout.Style{
+			Bold: span.Weight >= 600,
+			Italic: span.Italic,
+			Scale: span.Scale,
+		};
+		if span.Color != "" {
+			c, err := utils.ParseHexColor(span.Color);
+			if err != nil {
+				return nil, fmt.Errorf("span %d: %w", i, err);
+			}
+			style.Color = c;
+		}
+		if span.Scale != 0 && (span.Scale < min_span_scale || span.Scale > max_span_scale) {
+			return nil, fmt.Errorf("span %d: scale has to be between %g and %g", i, min_span_scale, max_span_scale);
+		}
+		runs = append(runs, layout.Run{ Text: span.Text, Style: style });
+	}
+	return runs, nil;
+}
+
+// quoteRuns is the quote as styled runs. spans win over the plain text,
+// which gets its markdown parsed.
+func (meta *Meta) quoteRuns() ([]layout.Run, error) {
+	if err := checkText("the text", meta.Text, meta.Spans); err != nil {
+		return nil, err;
+	}
+	if len(meta.Spans) > 0 {
+		return spansToRuns(meta.Spans);
+	}
+	return layout.ParseMarkdown(meta.Text), nil;
+}
+
+// authorRuns is the author line as styled runs. names are shown as they
+// are, without markdown.
+func (meta *Meta) authorRuns() ([]layout.Run, error) {
+	if err := checkText("the author", meta.Author, meta.AuthorSpans); err != nil {
+		return nil, err;
+	}
+	if len(meta.AuthorSpans) > 0 {
+		return spansToRuns(meta.AuthorSpans);
+	}
+	return []layout.Run{ { Text: meta.Author } }, nil;
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"os"
+	"sort"
+	"strings"
+
+	"canvas/lib/styles"
+	"canvas/lib/utils"
+)
+
+// ThemeMeta is a named set of colours and fonts. colours are hex, and
+// anything left empty is up to the style.
+type ThemeMeta struct {
+	Text string `json:"text"`
+	Author string `json:"author"`
+	Overlay string `json:"overlay"`
+	Border string `json:"border"`
+	Font string `json:"font"`
+	AuthorFont string `json:"author_font"`
+}
+
+// the themes every server has. a themes file can add to them or replace them.
+var themes = map[string]ThemeMeta{
+	"dark": {
+		Text: "#ffffff",
+		Author: "#d0d0d0",
+		Overlay: "#000000",
+		Border: "#ffffff",
+	},
+	"light": {
+		Text: "#1a1a1a",
+		Author: "#404040",
+		Overlay: "#ffffff",
+		Border: "#1a1a1a",
+	},
+	"sepia": {
+		Text: "#f4e4c1",
+		Author: "#d9c29a",
+		Overlay: "#3b2a1a",
+		Border: "#c8a46e",
+		Font: "Lora",
+	},
+	"neon": {
+		Text: "#39ff14",
+		Author: "#ff2fd0",
+		Overlay: "#0b0221",
+		Border: "#00e5ff",
+	},
+};
+
+// loadThemes reads a json object of name to theme from file and lays it
+// over the built in themes.
+func loadThemes(file string) error {
+	data, err := os.ReadFile(file);
+	if err != nil {
+		return fmt.Errorf("themes: %w", err);
+	}
+	var loaded map[string]ThemeMeta;
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return fmt.Errorf("themes: %s: %w", file, err);
+	}
+	for name, theme := range loaded {
+		themes[strings.ToLower(name)] = theme;
+	}
+	return nil;
+}
+
+// checkThemes makes sure every theme parses and only uses loaded fonts,
+// so a typo in the themes file fails at startup.
+func checkThemes() error {
+	for name, meta := range themes {
+		if _, _, err := meta.theme(); err != nil {
+			return fmt.Errorf("theme %s: %w", name, err);
+		}
+		for _, font := range []string{ meta.Font, meta.AuthorFont } {
+			if font == "" {
+				continue;
+			}
+			if err := registry.Require(font); err != nil {
+				return fmt.Errorf("theme %s: %w", name, err);
+			}
+		}
+	}
+	return nil;
+}
+
+// lookupTheme finds a theme by name, ignoring case. no name is no theme.
+func lookupTheme(name string) (ThemeMeta, error) {
+	if name == "" {
+		return ThemeMeta{}, nil;
+	}
+	meta, ok := themes[strings.ToLower(name)];
+	if !ok {
+		var names []string;
+		for n := range themes {
+			names = append(names, n);
+		}
+		sort.Strings(names);
+		return ThemeMeta{}, fmt.Errorf("unknown theme %q, have: %s", name, strings.Join(names, ", "));
+	}
+	return meta, nil;
+}
+
+// theme parses the colours. the overlay comes back on its own too, for the
+// classic gradient, and is nil when the theme doesn't have one.
+func (meta ThemeMeta) theme() (styles.Theme, *color.NRGBA, error) {
+	var theme styles.Theme;
+	var overlay *color.NRGBA;
+	fields := []struct {
+		name string
+		hex string
+		dst *color.Color
+	}{
+		{ "text", meta.Text, &theme.Text },
+		{ "author", meta.Author, &theme.Author },
+		{ "overlay", meta.Overlay, &theme.Overlay },
+		{ "border", meta.Border, &theme.Border },
+	};
+	for _, field := range fields {
+		if field.hex == "" {
+			continue;
+		}
+		c, err := utils.ParseHexNRGBA(field.hex);
+		if err != nil {
+			return styles.Theme{}, nil, fmt.Errorf("%s: %w", field.name, err);
+		}
+		*field.dst = c;
+		if field.name == "overlay" {
+			overlay = &c;
+		}
+	}
+	return theme, overlay, nil;
+}
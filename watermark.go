@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"canvas/lib/layout"
+	"canvas/lib/styles"
+	"canvas/lib/utils"
+)
+
+// WatermarkMeta is a watermark, see styles.Watermark. in the server's
+// config Image is a path in the asset dir, in a request it's a url.
+type WatermarkMeta struct {
+	Text string `json:"text"`
+	Image string `json:"image"`
+	Color string `json:"color"`
+	Position string `json:"position"`
+	Opacity *float64 `json:"opacity"`
+	Scale float64 `json:"scale"`
+	Off bool `json:"off"` // in a request, leaves the server's watermark off
+}
+
+// WatermarkConfig is the server's watermark, read from the -watermark
+// file. requests can only change it when AllowOverride is set.
+type WatermarkConfig struct {
+	WatermarkMeta
+	AllowOverride bool `json:"allow_override"`
+}
+
+const default_watermark_opacity = 0.6;
+
+// a watermark is a name or a handle, not a message.
+const max_watermark_length = 100;
+
+// the server's watermark, nil when it has none. its image is loaded once,
+// at startup.
+var server_watermark *WatermarkConfig;
+var server_watermark_image image.Image;
+
+// loadWatermark reads the server's watermark config and its image.
+func loadWatermark(file string, assets_dir string) error {
+	data, err := os.ReadFile(file);
+	if err != nil {
+		return fmt.Errorf("watermark: %w", err);
+	}
+	var config WatermarkConfig;
+	if err := json.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("watermark: %s: %w", file, err);
+	}
+	if config.Image != "" {
+		assets, err := openAssets(assets_dir);
+		if err != nil {
+			return err;
+		}
+		server_watermark_image, err = utils.OpenImage(assets, config.Image);
+		if err != nil {
+			return fmt.Errorf("watermark image: %w", err);
+		}
+	}
+	server_watermark = &config;
+	// check it now, so a mistake fails at startup and not on every request.
+	if !config.Off {
+		if _, err := config.watermark(server_watermark_image, nil); err != nil {
+			return fmt.Errorf("watermark: %w", err);
+		}
+	}
+	return nil;
+}
+
+// watermark turns meta into a style watermark with img as its image.
+func (meta WatermarkMeta) watermark(img image.Image, faces_at layout.FacesAt) (*styles.Watermark, error) {
+	if length := utf8.RuneCountInString(meta.Text); length > max_watermark_length {
+		return nil, fmt.Errorf("watermark text can be up to %d characters, got %d", max_watermark_length, length);
+	}
+	w := &styles.Watermark{
+		Text: meta.Text,
+		Faces: faces_at,
+		Image: img,
+		Position: strings.ToLower(meta.Position),
+		Opacity: default_watermark_opacity,
+		Scale: meta.Scale,
+	};
+	if meta.Opacity != nil {
+		w.Opacity = *meta.Opacity;
+	}
+	if meta.Color != "" {
+		c, err := utils.ParseHexColor(meta.Color);
+		if err != nil {
+			return nil, fmt.Errorf("watermark colour: %w", err);
+		}
+		w.Color = c;
+	}
+	return w, w.Validate();
+}
+
+// requestWatermark is the watermark a request gets: the server's, with the
+// request's changes laid over it when the server allows them. nil for none.
+func (meta *Meta) requestWatermark(fetch *fetcher, faces_at layout.FacesAt) (*styles.Watermark, error) {
+	asked := meta.Watermark;
+	if asked != nil && (server_watermark == nil || !server_watermark.AllowOverride) {
+		return nil, fmt.Errorf("this server doesn't let requests change the watermark");
+	}
+
+	var merged WatermarkMeta;
+	img := server_watermark_image;
+	if server_watermark != nil {
+		merged = server_watermark.WatermarkMeta;
+	}
+	if asked != nil {
+		if asked.Off {
+			return nil, nil;
+		}
+		// the request's fields win where it has them.
+		if asked.Text != "" || asked.Image != "" {
+			merged.Text, img = asked.Text, nil;
+		}
+		if asked.Image != "" {
+			logo, err := fetch.image(asked.Image);
+			if err != nil {
+				return nil, fmt.Errorf("Can't get watermark image from URL. %w", err);
+			}
+			img = logo.first();
+		}
+		merged.Off = false;
+		if asked.Color != "" {
+			merged.Color = asked.Color;
+		}
+		if asked.Position != "" {
+			merged.Position = asked.Position;
+		}
+		if asked.Opacity != nil {
+			merged.Opacity = asked.Opacity;
+		}
+		if asked.Scale != 0 {
+			merged.Scale = asked.Scale;
+		}
+	}
+	if merged.Off || (merged.Text == "" && img == nil) {
+		return nil, nil;
+	}
+	return merged.watermark(img, faces_at);
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// watermark text is a name or a handle, longer text is turned away.
+func TestWatermarkTextLength(t *testing.T) {
+	if _, err := (WatermarkMeta{ Text: strings.Repeat("é", max_watermark_length) }).watermark(nil, nil); err != nil {
+		t.Errorf("%d characters: %v", max_watermark_length, err);
+	}
+	if _, err := (WatermarkMeta{ Text: strings.Repeat("é", max_watermark_length + 1) }).watermark(nil, nil); err == nil {
+		t.Errorf("%d characters: want an error", max_watermark_length + 1);
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import "canvas/lib/styles"
+
+// render_slots is how many quotes can render at once, across /quote and
+// /batch. rendering takes a lot of cpu and memory, so the rest wait.
+var render_slots chan struct{};
+
+func setWorkers(n int) {
+	render_slots = make(chan struct{}, max(1, n));
+}
+
+// renderLimited is renderQuote, drawing once a worker is free. images are
+// fetched and decoded first, so a slow fetch doesn't hold a worker.
+func renderLimited(meta *Meta, cache *fetchCache, progress styles.Progress) (*Rendered, error) {
+	render, err := prepareQuote(meta, cache);
+	if err != nil {
+		return nil, err;
+	}
+	render_slots <- struct{}{};
+	defer func() { <-render_slots }();
+	return render(progress);
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// a quote waiting on a slow avatar doesn't hold the only worker, others
+// still render.
+func TestRenderLimitedFetchesOutsideSlot(t *testing.T) {
+	setupTest(t);
+	saved := render_slots;
+	setWorkers(1);
+	defer func() { render_slots = saved }();
+
+	asked, release := make(chan struct{}), make(chan struct{});
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(asked);
+		<-release;
+		http.Error(w, "gone", http.StatusNotFound);
+	}));
+	defer slow.Close();
+
+	stalled := make(chan error, 1);
+	go func() {
+		_, err := renderLimited(&Meta{ Gradient: defaultGradientMeta(), Url: slow.URL, Text: "slow" }, nil, nil);
+		stalled <- err;
+	}();
+	<-asked;
+
+	fast := testAvatar(t, 64, 64, 1);
+	done := make(chan error, 1);
+	go func() {
+		_, err := renderLimited(&Meta{ Gradient: defaultGradientMeta(), Url: fast, Text: "fast" }, nil, nil);
+		done <- err;
+	}();
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("the fast quote failed: %v", err);
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("the fast quote waited on the slow one's fetch");
+	}
+	close(release);
+	if err := <-stalled; err == nil {
+		t.Errorf("the slow quote's avatar 404s, but it rendered");
+	}
+}